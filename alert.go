@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// alertInterval 管理者へのアラートを送る最短間隔
+	alertInterval = time.Minute
+	// alertBurst 連続で送るアラートの最大数
+	alertBurst = 3
+)
+
+// alerter 管理者へのアラート送信に使う
+var alerter *Alerter
+
+// Alerter 管理者のLINEにアラートをレート制限付きで送る．イベントの外からも送るため，送り先は設定の読み込み時に受け取っておく
+type Alerter struct {
+	bot     *linebot.Client
+	limiter *rate.Limiter
+
+	mu     sync.Mutex
+	admins []string
+}
+
+// newAlerter アラートの送信元となるクライアントと設定を受け取り，Alerterを生成
+func newAlerter(bot *linebot.Client, conf *Config) *Alerter {
+	return &Alerter{
+		bot:     bot,
+		limiter: rate.NewLimiter(rate.Every(time.Duration(conf.Alert.Interval)), conf.Alert.Burst),
+		admins:  conf.AdminUserIDs,
+	}
+}
+
+// send 管理者全員にアラートを送る．制限を超えた分はログにのみ残す
+func (a *Alerter) send(text string) {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	admins := a.admins
+	a.mu.Unlock()
+	if len(admins) == 0 {
+		return
+	}
+	if !a.limiter.Allow() {
+		log.Printf("suppressed admin alert: %s", text)
+		return
+	}
+
+	if _, err := a.bot.Multicast(admins, linebot.NewTextMessage(text)).Do(); err != nil {
+		log.Print(err)
+	}
+}
+
+// update 読み込み直した設定に合わせ，送り先と送信頻度の上限を変更する
+func (a *Alerter) update(conf *Config) {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	a.admins = conf.AdminUserIDs
+	a.mu.Unlock()
+
+	a.limiter.SetLimit(rate.Every(time.Duration(conf.Alert.Interval)))
+	a.limiter.SetBurst(conf.Alert.Burst)
+}
+
+// apologyText 処理に失敗したときにユーザへ送る謝罪文
+const apologyText = "申し訳ありません．エラーが発生しました．時間をおいてもう一度お試し下さい"
+
+// reportError 外部APIの失敗などのエラーをログに出し，管理者に通知する．subject はユーザのIDや店のIDなど，どこで起きたかの手がかり
+func reportError(where string, subject string, err error) {
+	log.Printf("error in %s (%s): %v", where, subject, err)
+	alerter.send(fmt.Sprintf("[line-bot] error in %s (%s): %v", where, subject, err))
+}
+
+// reportPanic 回復したpanicをスタックトレース付きでログに出し，管理者に通知する
+func reportPanic(where string, eventID string, r interface{}) {
+	log.Printf("panic in %s (event %s): %v\n%s", where, eventID, r, debug.Stack())
+	alerter.send(fmt.Sprintf("[line-bot] panic in %s (event %s): %v", where, eventID, r))
+}
+
+// recoverJob バックグラウンド処理のpanicを回復する．fallback があれば回復後に実行する
+func recoverJob(name string, fallback func()) {
+	if r := recover(); r != nil {
+		reportPanic(name, "-", r)
+		if fallback != nil {
+			fallback()
+		}
+	}
+}
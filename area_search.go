@@ -0,0 +1,143 @@
+package main
+
+import (
+	"log"
+	"math"
+	"sort"
+
+	"googlemaps.github.io/maps"
+)
+
+const (
+	// gridCellMeters エリアを分割して検索するときの区画の一辺の目安（メートル）
+	gridCellMeters = 1000
+	// maxGridSide エリアを分割する区画の縦横それぞれの最大数
+	maxGridSide = 3
+	// maxAreaMeters エリアとして検索する範囲の対角線の最大長．これより広い場所は中心からの検索にする
+	maxAreaMeters = 10000
+)
+
+// areaTypes エリアとして範囲内を検索する場所の種類
+var areaTypes = []string{"locality", "sublocality", "sublocality_level_1", "sublocality_level_2", "neighborhood", "colloquial_area"}
+
+// areaBounds 場所がエリアであれば，その範囲を南西と北東の緯度・経度で返す．広すぎる場所やエリアでない場所は nil を返す
+func areaBounds(result maps.GeocodingResult) []float64 {
+	isArea := false
+	for _, areaType := range areaTypes {
+		if contains(result.Types, areaType) {
+			isArea = true
+			break
+		}
+	}
+	if !isArea {
+		return nil
+	}
+
+	viewport := result.Geometry.Viewport
+	bounds := []float64{viewport.SouthWest.Lat, viewport.SouthWest.Lng, viewport.NorthEast.Lat, viewport.NorthEast.Lng}
+	if diagonal := distance(bounds[:2], viewport.NorthEast); diagonal == 0 || diagonal > maxAreaMeters {
+		return nil
+	}
+
+	return bounds
+}
+
+// isAreaSearch エリアの範囲内を検索するか判定する
+func (q SearchQuery) isAreaSearch() bool {
+	return len(q.Bounds) == 4
+}
+
+// withinBounds 店がエリアの範囲内にあるか判定する
+func withinBounds(bounds []float64, point maps.LatLng) bool {
+	return point.Lat >= bounds[0] && point.Lng >= bounds[1] && point.Lat <= bounds[2] && point.Lng <= bounds[3]
+}
+
+// gridCells エリアを区画に分け，各区画の中心と区画を覆う半径を返す
+func gridCells(bounds []float64) ([]maps.LatLng, uint) {
+	south, west, north, east := bounds[0], bounds[1], bounds[2], bounds[3]
+	height := distance([]float64{south, west}, maps.LatLng{Lat: north, Lng: west})
+	width := distance([]float64{south, west}, maps.LatLng{Lat: south, Lng: east})
+
+	rows := gridSide(height)
+	cols := gridSide(width)
+
+	var centers []maps.LatLng
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			centers = append(centers, maps.LatLng{
+				Lat: south + (north-south)*(float64(row)+0.5)/float64(rows),
+				Lng: west + (east-west)*(float64(col)+0.5)/float64(cols),
+			})
+		}
+	}
+
+	radius := math.Hypot(height/float64(rows), width/float64(cols)) / 2
+	return centers, uint(math.Ceil(radius))
+}
+
+// gridSide 長さを区画に分けたときの区画の数を返す
+func gridSide(meters float64) int {
+	side := int(math.Ceil(meters / gridCellMeters))
+	if side < 1 {
+		return 1
+	}
+	if side > maxGridSide {
+		return maxGridSide
+	}
+	return side
+}
+
+// getAreaShopData エリアを区画に分けて店の種類ごとに検索し，重複を除いてエリア内の店を並び順に従って並べた結果一覧を返す
+func getAreaShopData(conf *Config, query SearchQuery, categories []CategoryConfig, keywords []string) ([][]maps.PlacesSearchResult, map[string]ScoreBreakdown, error) {
+	centers, radius := gridCells(query.Bounds)
+
+	var candidates []candidate
+	seen := map[string]bool{}
+	for i, category := range categories {
+		categoryQuery := query
+		categoryQuery.Category = category
+
+		for _, center := range centers {
+			request := &maps.NearbySearchRequest{
+				Location: &maps.LatLng{Lat: center.Lat, Lng: center.Lng},
+				Radius:   radius,
+				Keyword:  keywords[i],
+				Type:     category.PlaceType,
+				RankBy:   maps.RankByProminence,
+			}
+			query.Filters.apply(request)
+
+			shops, _, err := searchPlaces(request, categoryQuery)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, shop := range shops {
+				if seen[shop.PlaceID] || !withinBounds(query.Bounds, shop.Geometry.Location) {
+					continue
+				}
+				seen[shop.PlaceID] = true
+				candidates = append(candidates, candidate{shop: shop, weights: conf.Ranking.weights(category)})
+			}
+		}
+	}
+	log.Printf("area search: %d cells, %d shops", len(centers), len(candidates))
+
+	var shops []maps.PlacesSearchResult
+	var scores map[string]ScoreBreakdown
+	switch query.Range.RankBy {
+	case rankByScore:
+		shops, scores = rankShops(candidates, query.Origin, conf.Ranking)
+	default:
+		for _, c := range candidates {
+			shops = append(shops, c.shop)
+		}
+		sort.SliceStable(shops, func(i, j int) bool {
+			if query.Range.RankBy == rankByProminence {
+				return shops[i].UserRatingsTotal > shops[j].UserRatingsTotal
+			}
+			return distance(query.Origin, shops[i].Geometry.Location) < distance(query.Origin, shops[j].Geometry.Location)
+		})
+	}
+
+	return splitShops(shops, conf.PageSize), scores, nil
+}
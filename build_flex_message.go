@@ -1,13 +1,16 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"log"
 	"math"
 	"net/url"
 	"reflect"
 	"strings"
 	"time"
 
+	"github.com/line/line-bot-sdk-go/linebot"
 	"googlemaps.github.io/maps"
 )
 
@@ -59,9 +62,10 @@ type FlexMessage struct {
 
 // Flex Flex Messageの要素
 type Flex struct {
-	Type     componentType `json:"type"`
-	AltText  string        `json:"altText"`
-	Contents Carousel      `json:"contents"`
+	Type       componentType            `json:"type"`
+	AltText    string                   `json:"altText"`
+	Contents   Carousel                 `json:"contents"`
+	QuickReply *linebot.QuickReplyItems `json:"quickReply,omitempty"`
 }
 
 // Carousel Flex Messageの要素
@@ -88,6 +92,19 @@ type Box struct {
 	Contents   []ContentsContainer `json:"contents"`
 }
 
+// MarshalJSON 構築できずに nil になった要素を除いて書き出す
+func (b Box) MarshalJSON() ([]byte, error) {
+	type box Box
+	var contents []ContentsContainer
+	for _, content := range b.Contents {
+		if content != nil && !reflect.ValueOf(content).IsNil() {
+			contents = append(contents, content)
+		}
+	}
+	b.Contents = contents
+	return json.Marshal(box(b))
+}
+
 // Button Flex Messageの要素
 type Button struct {
 	Type    componentType `json:"type"`
@@ -130,6 +147,7 @@ type Icon struct {
 type Image struct {
 	Type        componentType `json:"type"`
 	URL         string        `json:"url"`
+	Flex        int           `json:"flex,omitempty"`
 	Gravity     string        `json:"gravity,omitempty"`
 	Size        componentSize `json:"size,omitempty"`
 	AspectRatio string        `json:"aspectRatio,omitempty"`
@@ -190,34 +208,42 @@ const (
 )
 
 // getFlexMessage Flex Message を構築し，返す
-func getFlexMessage(bubbles []*Bubble, replyToken string) FlexMessage {
+func getFlexMessage(bubbles []*Bubble, altText string, replyToken string, quickReply *linebot.QuickReplyItems) FlexMessage {
 	return FlexMessage{
 		ReplyToken: replyToken,
 		Messages: []Flex{
-			buildFlexComponent(bubbles),
+			buildFlexComponent(bubbles, altText, quickReply),
 		},
 	}
 }
 
 // buildFlexComponent Flex Component を構築
-func buildFlexComponent(bubbles []*Bubble) Flex {
+func buildFlexComponent(bubbles []*Bubble, altText string, quickReply *linebot.QuickReplyItems) Flex {
 	return Flex{
 		Type:    typeFlex,
-		AltText: "検索結果",
+		AltText: altText,
 		Contents: Carousel{
 			Type:     "carousel",
 			Contents: bubbles,
 		},
+		QuickReply: quickReply,
 	}
 }
 
 // buildResultBubble バブルを構築し，返す
-func getBubble(shopDetail maps.PlaceDetailsResult, photo []string) *Bubble {
+func getBubble(shopDetail maps.PlaceDetailsResult, photo []string, conf *Config, query SearchQuery, travel Travel, label string) *Bubble {
+	body := buildResultBubbleBody(shopDetail, conf.Theme, travel, label)
+	if favorite, ok := query.Favorites[shopDetail.PlaceID]; ok {
+		if note := buildFavoriteNote(favorite, conf.Theme); note != nil {
+			body.Contents = append(body.Contents, note)
+		}
+	}
+
 	return &Bubble{
 		Type:   typeBubble,
 		Header: buildResultBubbleHeder(photo),
-		Body:   buildResultBubbleBody(shopDetail),
-		Footer: buildResultBubbleFooter(shopDetail),
+		Body:   body,
+		Footer: buildResultBubbleFooter(shopDetail, query, conf.Travel.InlineRoute),
 	}
 }
 
@@ -276,29 +302,34 @@ func buildImageComponent(photoURL string, aspectRatio string) *Image {
 	}
 }
 
-// buildResultBubbleBody ボディを構築
-func buildResultBubbleBody(shopDetail maps.PlaceDetailsResult) *Box {
+// buildResultBubbleBody ボディを構築．店名には地図のピンと同じ番号を付ける
+func buildResultBubbleBody(shopDetail maps.PlaceDetailsResult, theme ThemeConfig, travel Travel, label string) *Box {
+	name := shopDetail.Name
+	if len(label) > 0 {
+		name = label + ". " + name
+	}
+
 	return &Box{
 		Type:   typeBox,
 		Layout: layoutVertical,
 		Contents: []ContentsContainer{
 			&Text{
 				Type:   typeText,
-				Text:   shopDetail.Name,
+				Text:   name,
 				Size:   sizeLg,
 				Wrap:   true,
 				Weight: "bold",
 			},
-			buildEvaluation(shopDetail.Rating, shopDetail.UserRatingsTotal),
-			buildStoreInformation(shopDetail.Vicinity, shopDetail.OpeningHours),
+			buildEvaluation(shopDetail.Rating, shopDetail.UserRatingsTotal, theme),
+			buildStoreInformation(shopDetail.Vicinity, shopDetail.OpeningHours, travel, theme),
 		},
 	}
 }
 
 // buildEvaluation 店の評価（星の数と評価件数）を構築
-func buildEvaluation(rating float32, ratingCount int) *Box {
+func buildEvaluation(rating float32, ratingCount int, theme ThemeConfig) *Box {
 	icons := buildIconComponents(rating)
-	evaluation := buildEvaluationText(rating, ratingCount)
+	evaluation := buildEvaluationText(rating, ratingCount, theme.Rating)
 
 	return &Box{
 		Type:   typeBox,
@@ -342,7 +373,7 @@ func buildIconComponent(url string) *Icon {
 }
 
 // buildEvaluationText 評価値と評価件数を構築
-func buildEvaluationText(rating float32, ratingCount int) *Text {
+func buildEvaluationText(rating float32, ratingCount int, color string) *Text {
 	value := math.Round(float64(rating))
 
 	return &Text{
@@ -350,26 +381,30 @@ func buildEvaluationText(rating float32, ratingCount int) *Text {
 		Text:   fmt.Sprint(value) + "(" + fmt.Sprint(ratingCount) + ")",
 		Margin: sizeMd,
 		Size:   sizeSm,
-		Color:  "#999999",
+		Color:  color,
 	}
 }
 
-// buildStoreInformation 店の情報（住所，営業時間）を構築
-func buildStoreInformation(address string, openingHours *maps.OpeningHours) *Box {
+// buildStoreInformation 店の情報（住所，距離，営業時間）を構築
+func buildStoreInformation(address string, openingHours *maps.OpeningHours, travel Travel, theme ThemeConfig) *Box {
+	contents := []ContentsContainer{buildStoreAddress(address, theme)}
+	// 検索地点を指定しない自由な言葉での検索では距離を表示しない
+	if len(travel.Mode) > 0 {
+		contents = append(contents, buildStoreTravel(travel, theme))
+	}
+	contents = append(contents, buildStoreOpeningHours(openingHours, theme))
+
 	return &Box{
-		Type:    typeBox,
-		Layout:  layoutVertical,
-		Margin:  sizeMd,
-		Spacing: sizeSm,
-		Contents: []ContentsContainer{
-			buildStoreAddress(address),
-			buildStoreOpeningHours(openingHours),
-		},
+		Type:     typeBox,
+		Layout:   layoutVertical,
+		Margin:   sizeMd,
+		Spacing:  sizeSm,
+		Contents: contents,
 	}
 }
 
 // buildStoreAddress 店の住所を構築
-func buildStoreAddress(address string) *Box {
+func buildStoreAddress(address string, theme ThemeConfig) *Box {
 	return &Box{
 		Type:    typeBox,
 		Layout:  layoutBaseline,
@@ -380,7 +415,7 @@ func buildStoreAddress(address string) *Box {
 				Text:  "場所",
 				Flex:  1,
 				Size:  sizeSm,
-				Color: "#aaaaaa",
+				Color: theme.Label,
 			},
 			&Text{
 				Type:  typeText,
@@ -388,31 +423,44 @@ func buildStoreAddress(address string) *Box {
 				Flex:  5,
 				Wrap:  true,
 				Size:  sizeSm,
-				Color: "#666666",
+				Color: theme.Text,
 			},
 		},
 	}
 }
 
+// buildStoreTravel 検索地点から店までの距離と所要時間を構築
+func buildStoreTravel(travel Travel, theme ThemeConfig) *Box {
+	return &Box{
+		Type:    typeBox,
+		Layout:  layoutBaseline,
+		Spacing: sizeSm,
+		Contents: []ContentsContainer{
+			buildStoreInformationText("距離", 1, theme.Label),
+			buildStoreInformationText(travel.describe(), 3, theme.Text),
+		},
+	}
+}
+
 // buildStoreOpeningHours 店の営業時間を構築
-func buildStoreOpeningHours(openingHours *maps.OpeningHours) *Box {
-	businessHours, status, color := buildStoreOpeningHoursPeriod(openingHours)
+func buildStoreOpeningHours(openingHours *maps.OpeningHours, theme ThemeConfig) *Box {
+	businessHours, status, color := buildStoreOpeningHoursPeriod(openingHours, theme)
 
 	return &Box{
 		Type:    typeBox,
 		Layout:  layoutBaseline,
 		Spacing: sizeSm,
 		Contents: []ContentsContainer{
-			buildStoreInformationText("営業時間", 1, "#aaaaaa"),
+			buildStoreInformationText("営業時間", 1, theme.Label),
 			buildStoreInformationText(businessHours+" "+status, 3, color),
 		},
 	}
 }
 
 // buildStoreOpeningHoursPeriod 営業時間によって営業ステータスと色を変化させて構築
-func buildStoreOpeningHoursPeriod(openingHours *maps.OpeningHours) (string, string, string) {
+func buildStoreOpeningHoursPeriod(openingHours *maps.OpeningHours, theme ThemeConfig) (string, string, string) {
 	if reflect.ValueOf(openingHours).IsNil() {
-		return "", "営業時間未記載", "#666666"
+		return "", "営業時間未記載", theme.Text
 	}
 
 	for _, period := range (*openingHours).Periods {
@@ -421,18 +469,24 @@ func buildStoreOpeningHoursPeriod(openingHours *maps.OpeningHours) (string, stri
 			close := period.Close.Time
 			businessHours := applyTimeFormat(open, close)
 
+			if openingHours.OpenNow == nil {
+				return businessHours, "", theme.Text
+			}
 			if *openingHours.OpenNow {
-				return businessHours, "(営業中)", "#32cd32"
+				return businessHours, "(営業中)", theme.Open
 			}
-			return businessHours, "(準備中)", "#ff0000"
+			return businessHours, "(準備中)", theme.Closed
 		}
 	}
 
-	return "", "定休日", "#ff0000"
+	return "", "定休日", theme.Closed
 }
 
 // applyTimeFormat 時間の表記に変更
 func applyTimeFormat(open string, close string) string {
+	if len(open) < 4 || len(close) < 4 {
+		return open + " ~ " + close
+	}
 	return open[:2] + ":" + open[2:] + " ~ " + close[:2] + ":" + close[2:]
 }
 
@@ -447,8 +501,38 @@ func buildStoreInformationText(text string, flex int, color string) *Text {
 	}
 }
 
-// buildResultBubbleFooter フッターを構築
-func buildResultBubbleFooter(shopDetail maps.PlaceDetailsResult) *Box {
+// buildResultBubbleFooter フッターを構築．inlineRoute であれば経路をトークで見るボタンも加える
+func buildResultBubbleFooter(shopDetail maps.PlaceDetailsResult, query SearchQuery, inlineRoute bool) *Box {
+	contents := []ContentsContainer{
+		buildURIActionButtonComponent(buildDirectionsURL(query.Origin, shopDetail, query.TravelMode), "ここへ行く"),
+	}
+	if inlineRoute {
+		contents = append(contents, buildPostbackActionButtonComponent("経路をトークで見る", routePostback(query.Origin, shopDetail.PlaceID, query.TravelMode)))
+	}
+	contents = append(contents, buildShopLinkButtons(shopDetail)...)
+	if _, ok := query.Favorites[shopDetail.PlaceID]; ok {
+		contents = append(contents, buildPostbackActionButtonComponent("リスト・メモ", PostbackData{Action: actionFavoriteMenu, PlaceID: shopDetail.PlaceID}))
+	} else {
+		contents = append(contents, buildPostbackActionButtonComponent("お気に入りに追加", PostbackData{Action: actionAddFavorite, PlaceID: shopDetail.PlaceID}))
+	}
+	if query.Explain {
+		contents = append(contents, buildPostbackActionButtonComponent("順位の理由", PostbackData{Action: actionExplainRank, PlaceID: shopDetail.PlaceID}))
+	}
+	contents = append(contents, &Spacer{
+		Type: typeSpacer,
+		Size: sizeSm,
+	})
+
+	return &Box{
+		Type:     typeBox,
+		Layout:   layoutVertical,
+		Spacing:  sizeSm,
+		Contents: contents,
+	}
+}
+
+// buildShopLinkButtons GoogleMapと店のWebサイトを開くボタンを構築．Webサイトがなければ店名で検索する
+func buildShopLinkButtons(shopDetail maps.PlaceDetailsResult) []ContentsContainer {
 	buttonURI := buildURIActionButtonComponent(shopDetail.URL, "GoogleMapを開く")
 	var buttonWebSite *Button
 	webSite := shopDetail.Website
@@ -460,19 +544,7 @@ func buildResultBubbleFooter(shopDetail maps.PlaceDetailsResult) *Box {
 		buttonWebSite = buildURIActionButtonComponent(webSite, "お店をGoogleで検索する")
 	}
 
-	return &Box{
-		Type:    typeBox,
-		Layout:  layoutVertical,
-		Spacing: sizeSm,
-		Contents: []ContentsContainer{
-			buttonURI,
-			buttonWebSite,
-			&Spacer{
-				Type: typeSpacer,
-				Size: sizeSm,
-			},
-		},
-	}
+	return []ContentsContainer{buttonURI, buttonWebSite}
 }
 
 func removeSpace(term string) string {
@@ -505,24 +577,74 @@ func getNextActionBubble() *Bubble {
 			Type:   typeBox,
 			Layout: layoutVertical,
 			Contents: []ContentsContainer{
-				buildPostbackActionButtonComponent("次の10件を検索", "next"),
+				buildPostbackActionButtonComponent("次の10件を検索", PostbackData{Action: actionNext}),
 			},
 		},
 	}
 }
 
-// buildPostbackActionButtonComponent postbackメッセージを構築
-func buildPostbackActionButtonComponent(label string, data string) *Button {
+// getOverviewMapBubble 検索地点と番号付きの店の位置を示す地図のバブルを返す
+func getOverviewMapBubble(mapURL string) *Bubble {
+	return &Bubble{
+		Type: typeBubble,
+		Header: &Box{
+			Type:       typeBox,
+			Layout:     layoutVertical,
+			PaddingAll: "0px",
+			Contents: []ContentsContainer{
+				buildImageComponent(mapURL, "3:2"),
+			},
+		},
+		Body: &Box{
+			Type:   typeBox,
+			Layout: layoutVertical,
+			Contents: []ContentsContainer{
+				&Text{
+					Type:   typeText,
+					Text:   "周辺の地図",
+					Size:   sizeLg,
+					Weight: "bold",
+				},
+				&Text{
+					Type:   typeText,
+					Text:   "青いピンが検索地点，番号は各店のバブルの番号です",
+					Margin: sizeMd,
+					Size:   sizeSm,
+					Wrap:   true,
+				},
+			},
+		},
+	}
+}
+
+// buildPostbackActionButtonComponent postbackメッセージを構築．データを符号化できなければ nil を返し，ボタンを外す
+func buildPostbackActionButtonComponent(label string, data PostbackData) *Button {
+	action := buildPostbackAction(label, data)
+	if action == nil {
+		return nil
+	}
+
 	return &Button{
 		Type:    typeButton,
 		Height:  sizeMd,
 		Style:   "link",
 		Flex:    5,
 		Gravity: "center",
-		Action: &PostbackAction{
-			Type:  "postback",
-			Label: label,
-			Data:  data,
-		},
+		Action:  action,
+	}
+}
+
+// buildPostbackAction ポストバックアクションを構築．データが長すぎるなどで符号化できなければログに残して nil を返す
+func buildPostbackAction(label string, data PostbackData) *PostbackAction {
+	encoded, err := codec.encode(data)
+	if err != nil {
+		log.Printf("dropped %q button: %v", label, err)
+		return nil
+	}
+
+	return &PostbackAction{
+		Type:  "postback",
+		Label: label,
+		Data:  encoded,
 	}
 }
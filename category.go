@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"googlemaps.github.io/maps"
+)
+
+// CategoryConfig 検索できる店の種類
+type CategoryConfig struct {
+	Key       string          `json:"key"`
+	Name      string          `json:"name"`
+	Group     string          `json:"group,omitempty"`
+	Keyword   string          `json:"keyword"`
+	Gendered  bool            `json:"gendered,omitempty"`
+	PlaceType maps.PlaceType  `json:"placeType"`
+	Icon      string          `json:"icon,omitempty"`
+	Include   []string        `json:"include,omitempty"`
+	Exclude   []string        `json:"exclude,omitempty"`
+	Weights   *RankingWeights `json:"weights,omitempty"`
+	Synonyms  []string        `json:"synonyms,omitempty"`
+}
+
+// defaultCategories 店の種類の既定値
+func defaultCategories() []CategoryConfig {
+	return []CategoryConfig{
+		{
+			Key:       "used",
+			Name:      "古着屋",
+			Group:     "衣料品",
+			Keyword:   "古着屋",
+			Gendered:  true,
+			PlaceType: maps.PlaceTypeClothingStore,
+			Synonyms:  []string{"古着", "古着店", "ヴィンテージショップ"},
+		},
+		{
+			Key:       "select",
+			Name:      "セレクトショップ",
+			Group:     "衣料品",
+			Keyword:   "セレクトショップ",
+			Gendered:  true,
+			PlaceType: maps.PlaceTypeClothingStore,
+			Synonyms:  []string{"セレクト"},
+		},
+		{
+			Key:       "other",
+			Name:      "その他の衣料品店",
+			Group:     "衣料品",
+			Keyword:   "衣料品ブランド || Clothing Brand",
+			Gendered:  true,
+			PlaceType: maps.PlaceTypeClothingStore,
+			Synonyms:  []string{"服屋", "洋服屋", "アパレル"},
+		},
+		{
+			Key:       "cafe",
+			Name:      "カフェ",
+			Group:     "飲食",
+			Keyword:   "カフェ || Cafe",
+			PlaceType: maps.PlaceTypeCafe,
+			Synonyms:  []string{"喫茶店", "喫茶", "コーヒー", "cafe"},
+		},
+	}
+}
+
+// category キーに対応する店の種類を返す
+func (c *Config) category(key string) (CategoryConfig, bool) {
+	for _, category := range c.Categories {
+		if category.Key == key {
+			return category, true
+		}
+	}
+	return CategoryConfig{}, false
+}
+
+// categories キーに対応する店の種類を返す．見つからないキーは無視する
+func (c *Config) categories(keys []string) []CategoryConfig {
+	var categories []CategoryConfig
+	for _, key := range keys {
+		if category, ok := c.category(key); ok {
+			categories = append(categories, category)
+		}
+	}
+	return categories
+}
+
+// query 店の種類の検索用語を，追加のキーワードを含めて返す
+func (cc CategoryConfig) query() string {
+	if len(cc.Include) == 0 {
+		return cc.Keyword
+	}
+
+	terms := []string{"(" + cc.Keyword + ")"}
+	for _, include := range cc.Include {
+		terms = append(terms, "("+include+")")
+	}
+	return strings.Join(terms, " || ")
+}
+
+// excludes 除外キーワードを店名に含むか判定する
+func (cc CategoryConfig) excludes(shop maps.PlacesSearchResult) bool {
+	for _, exclude := range cc.Exclude {
+		if strings.Contains(strings.ToLower(shop.Name), strings.ToLower(exclude)) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateCategories 店の種類の設定の問題点を返す
+func validateCategories(categories []CategoryConfig) []string {
+	var problems []string
+
+	if len(categories) == 0 {
+		problems = append(problems, "at least one category is required")
+	}
+
+	keys := map[string]bool{}
+	for i, category := range categories {
+		if len(category.Key) == 0 {
+			problems = append(problems, fmt.Sprintf("categories[%d]: key is empty", i))
+		}
+		if keys[category.Key] {
+			problems = append(problems, fmt.Sprintf("categories[%d]: duplicate key %q", i, category.Key))
+		}
+		keys[category.Key] = true
+
+		if len(category.Name) == 0 {
+			problems = append(problems, fmt.Sprintf("categories[%d]: name is empty", i))
+		}
+		if len(category.Keyword) == 0 {
+			problems = append(problems, fmt.Sprintf("categories[%d]: keyword is empty", i))
+		}
+		if len(category.PlaceType) == 0 {
+			continue
+		}
+		if _, err := maps.ParsePlaceType(string(category.PlaceType)); err != nil {
+			problems = append(problems, fmt.Sprintf("categories[%d]: %v", i, err))
+		}
+	}
+
+	return problems
+}
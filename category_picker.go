@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+const (
+	// pickerRowsPerBubble 1つのバブルに並べる店の種類の数
+	pickerRowsPerBubble = 6
+	// carouselMaxBubbles カルーセルに入れられるバブルの最大数
+	carouselMaxBubbles = 12
+	// defaultCategoryGroup グループが設定されていない店の種類のグループ名
+	defaultCategoryGroup = "その他"
+)
+
+// categoryPickerMessage 店の種類を選ぶFlex Messageを構築する
+func categoryPickerMessage(categories []CategoryConfig, selected []string, page int) linebot.SendingMessage {
+	return toFlexMessage("検索する店の種類を選んで下さい", buildCategoryPicker(categories, selected, page))
+}
+
+// buildCategoryPicker グループごとに店の種類を並べたカルーセルを構築する．収まらない場合はページに分ける
+func buildCategoryPicker(categories []CategoryConfig, selected []string, page int) *Carousel {
+	var bubbles []*Bubble
+	for _, group := range groupCategories(categories) {
+		for start := 0; start < len(group); start += pickerRowsPerBubble {
+			end := start + pickerRowsPerBubble
+			if end > len(group) {
+				end = len(group)
+			}
+			bubbles = append(bubbles, buildCategoryBubble(group[start:end], selected, page))
+		}
+	}
+
+	if len(bubbles) > carouselMaxBubbles {
+		perPage := carouselMaxBubbles - 1
+		lastPage := (len(bubbles) - 1) / perPage
+		if page < 0 || page > lastPage {
+			page = 0
+		}
+
+		start := page * perPage
+		end := start + perPage
+		if end > len(bubbles) {
+			end = len(bubbles)
+		}
+		bubbles = append(bubbles[start:end], buildPickerPagingBubble(page, lastPage))
+	}
+
+	return &Carousel{
+		Type:     typeCarousel,
+		Contents: bubbles,
+	}
+}
+
+// groupCategories 店の種類を設定の順序を保ったままグループに分ける
+func groupCategories(categories []CategoryConfig) [][]CategoryConfig {
+	var groups [][]CategoryConfig
+	index := map[string]int{}
+
+	for _, category := range categories {
+		name := category.groupName()
+		i, ok := index[name]
+		if !ok {
+			i = len(groups)
+			index[name] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], category)
+	}
+
+	return groups
+}
+
+// buildCategoryBubble 1つのグループの店の種類を並べたバブルを構築する
+func buildCategoryBubble(categories []CategoryConfig, selected []string, page int) *Bubble {
+	contents := []ContentsContainer{
+		&Text{
+			Type:   typeText,
+			Text:   categories[0].groupName(),
+			Size:   sizeLg,
+			Weight: "bold",
+		},
+	}
+	for _, category := range categories {
+		contents = append(contents, buildCategoryRow(category, contains(selected, category.Key), page))
+	}
+
+	bubble := &Bubble{
+		Type: typeBubble,
+		Body: &Box{
+			Type:     typeBox,
+			Layout:   layoutVertical,
+			Spacing:  sizeSm,
+			Contents: contents,
+		},
+	}
+
+	if len(selected) > 0 {
+		bubble.Footer = &Box{
+			Type:   typeBox,
+			Layout: layoutVertical,
+			Contents: []ContentsContainer{
+				buildPostbackActionButtonComponent("選択した"+strconv.Itoa(len(selected))+"種類で検索", PostbackData{Action: actionSearchSelected}),
+			},
+		}
+	}
+
+	return bubble
+}
+
+// buildCategoryRow アイコン，単独で選ぶボタン，複数選択に加えるボタンを並べた行を構築する．ボタンを構築できなければ nil を返す
+func buildCategoryRow(category CategoryConfig, selected bool, page int) *Box {
+	var contents []ContentsContainer
+	if len(category.Icon) > 0 {
+		contents = append(contents, &Image{
+			Type:        typeImage,
+			URL:         category.Icon,
+			Flex:        1,
+			Gravity:     "center",
+			Size:        "xxs",
+			AspectRatio: "1:1",
+			AspectMode:  "cover",
+		})
+	}
+
+	toggleLabel := "＋"
+	if selected {
+		toggleLabel = "✓"
+	}
+
+	pick := buildPostbackAction(category.Name, PostbackData{Action: actionCategory, Category: category.Key})
+	toggle := buildPostbackAction(toggleLabel, PostbackData{Action: actionToggleCategory, Category: category.Key, Page: page})
+	if pick == nil || toggle == nil {
+		return nil
+	}
+
+	contents = append(contents,
+		&Button{
+			Type:    typeButton,
+			Height:  sizeSm,
+			Style:   "link",
+			Flex:    4,
+			Gravity: "center",
+			Action:  pick,
+		},
+		&Button{
+			Type:    typeButton,
+			Height:  sizeSm,
+			Style:   "secondary",
+			Flex:    1,
+			Gravity: "center",
+			Action:  toggle,
+		},
+	)
+
+	return &Box{
+		Type:     typeBox,
+		Layout:   layoutHorizontal,
+		Spacing:  sizeSm,
+		Contents: contents,
+	}
+}
+
+// buildPickerPagingBubble 前後のページに移動するボタンのバブルを構築する
+func buildPickerPagingBubble(page int, lastPage int) *Bubble {
+	var contents []ContentsContainer
+	if page > 0 {
+		contents = append(contents, buildPostbackActionButtonComponent("前の種類を見る", PostbackData{Action: actionPicker, Page: page - 1}))
+	}
+	if page < lastPage {
+		contents = append(contents, buildPostbackActionButtonComponent("他の種類を見る", PostbackData{Action: actionPicker, Page: page + 1}))
+	}
+
+	return &Bubble{
+		Type: typeBubble,
+		Body: &Box{
+			Type:     typeBox,
+			Layout:   layoutVertical,
+			Contents: contents,
+		},
+	}
+}
+
+// groupName 店の種類のグループ名を返す
+func (cc CategoryConfig) groupName() string {
+	if len(cc.Group) == 0 {
+		return defaultCategoryGroup
+	}
+	return cc.Group
+}
+
+// toFlexMessage 構築したカルーセルをLINE SDKのFlex Messageに変換する
+func toFlexMessage(altText string, carousel *Carousel) linebot.SendingMessage {
+	data, err := json.Marshal(carousel)
+	if err != nil {
+		log.Print(err)
+		return linebot.NewTextMessage(altText)
+	}
+
+	container, err := linebot.UnmarshalFlexMessageJSON(data)
+	if err != nil {
+		log.Print(err)
+		return linebot.NewTextMessage(altText)
+	}
+
+	return linebot.NewFlexMessage(altText, container)
+}
+
+// contains スライスに文字列が含まれるか判定する
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"googlemaps.github.io/maps"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// defaultPageSize 1ページに表示する店の数の既定値
+	defaultPageSize = 10
+	// maxPageSize カルーセルに収まる店の数の上限
+	maxPageSize = 10
+	// defaultReloadInterval 設定ファイルの更新を確認する間隔の既定値
+	defaultReloadInterval = 10 * time.Second
+)
+
+// config 現在の設定．再読み込みの際に丸ごと差し替える
+var config atomic.Value
+
+// Config ボットの設定
+type Config struct {
+	ChannelSecret  string              `json:"channelSecret"`
+	ChannelToken   string              `json:"channelToken"`
+	GCPAPIKey      string              `json:"gcpApiKey"`
+	Port           string              `json:"port"`
+	PublicURL      string              `json:"publicUrl"`
+	AdminUserIDs   []string            `json:"adminUserIds"`
+	PostbackTTL    Duration            `json:"postbackTtl"`
+	ReloadInterval Duration            `json:"reloadInterval"`
+	PageSize       int                 `json:"pageSize"`
+	RateLimit      RateLimitConfig     `json:"rateLimit"`
+	Alert          RateLimitConfig     `json:"alert"`
+	Theme          ThemeConfig         `json:"theme"`
+	Categories     []CategoryConfig    `json:"categories"`
+	Genders        []GenderConfig      `json:"genders"`
+	Styles         []string            `json:"styles"`
+	RadiusOptions  []uint              `json:"radiusOptions"`
+	Commands       map[string][]string `json:"commands"`
+	Ranking        RankingConfig       `json:"ranking"`
+	Travel         TravelConfig        `json:"travel"`
+	Geocode        GeocodeConfig       `json:"geocode"`
+	Expansion      ExpansionConfig     `json:"expansion"`
+	// StorePath お気に入りと検索履歴を保存するJSONファイル．Heroku のように再起動でファイルが消える環境では，永続化されるディスク上のパスを指定する
+	StorePath string `json:"storePath"`
+
+	path string
+}
+
+// ThemeConfig 検索結果のバブルで使う色
+type ThemeConfig struct {
+	Rating string `json:"rating"`
+	Label  string `json:"label"`
+	Text   string `json:"text"`
+	Open   string `json:"open"`
+	Closed string `json:"closed"`
+}
+
+// RateLimitConfig レート制限の設定
+type RateLimitConfig struct {
+	Interval Duration `json:"interval"`
+	Burst    int      `json:"burst"`
+}
+
+// Duration "1m" のような文字列で設定できる time.Duration
+type Duration time.Duration
+
+// UnmarshalJSON 文字列表記の時間を読み込む
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"1m\": %s", data)
+	}
+
+	value, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(value)
+
+	return nil
+}
+
+// MarshalJSON 時間を文字列表記で書き出す
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// defaultConfig 設定の既定値を返す
+func defaultConfig() *Config {
+	return &Config{
+		Port:           "8080",
+		PostbackTTL:    Duration(postbackTTL),
+		ReloadInterval: Duration(defaultReloadInterval),
+		PageSize:       defaultPageSize,
+		RateLimit: RateLimitConfig{
+			Interval: Duration(userRateInterval),
+			Burst:    userRateBurst,
+		},
+		Alert: RateLimitConfig{
+			Interval: Duration(alertInterval),
+			Burst:    alertBurst,
+		},
+		Theme: ThemeConfig{
+			Rating: "#999999",
+			Label:  "#aaaaaa",
+			Text:   "#666666",
+			Open:   "#32cd32",
+			Closed: "#ff0000",
+		},
+		Categories:    defaultCategories(),
+		Genders:       defaultGenders(),
+		Styles:        defaultStyles(),
+		RadiusOptions: defaultRadiusOptions(),
+		Commands:      defaultCommands(),
+		Ranking:       defaultRankingConfig(),
+		Travel:        defaultTravelConfig(),
+		Geocode:       defaultGeocodeConfig(),
+		Expansion:     defaultExpansionConfig(),
+		StorePath:     "data/store.json",
+	}
+}
+
+// currentConfig 現在の設定を返す．返した設定は差し替え後も変更されない
+func currentConfig() *Config {
+	return config.Load().(*Config)
+}
+
+// setConfig 設定を差し替える
+func setConfig(conf *Config) {
+	config.Store(conf)
+}
+
+// loadConfig 既定値，設定ファイル，環境変数，コマンドライン引数の順に設定を読み込み，検証する
+func loadConfig(args []string) (*Config, error) {
+	flags := flag.NewFlagSet("line-bot", flag.ContinueOnError)
+	path := flags.String("config", os.Getenv("CONFIG_FILE"), "path to a JSON or YAML config file")
+	port := flags.String("port", "", "port to listen on")
+	admins := flags.String("admin-user-ids", "", "comma separated LINE user IDs of admins")
+	storePath := flags.String("store-path", "", "path to the JSON file that keeps favorites and search history")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	conf := defaultConfig()
+	conf.path = *path
+	if len(*path) > 0 {
+		if err := conf.loadFile(*path); err != nil {
+			return nil, err
+		}
+	}
+	conf.loadEnv()
+
+	if len(*port) > 0 {
+		conf.Port = *port
+	}
+	if len(*admins) > 0 {
+		conf.AdminUserIDs = splitList(*admins)
+	}
+	if len(*storePath) > 0 {
+		conf.StorePath = *storePath
+	}
+
+	if err := conf.validate(); err != nil {
+		return nil, err
+	}
+
+	return conf, nil
+}
+
+// loadFile JSON形式かYAML形式の設定ファイルを読み込む．YAMLはJSONに変換し，同じキー名と検証で読み込む
+func (c *Config) loadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config %s: %v", path, err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+	case ".yaml", ".yml":
+		if data, err = yamlToJSON(data); err != nil {
+			return fmt.Errorf("config %s: %v", path, err)
+		}
+	default:
+		return fmt.Errorf("config %s: unknown file type", path)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("config %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// yamlToJSON YAMLの文書をJSONに変換する
+func yamlToJSON(data []byte) ([]byte, error) {
+	var value interface{}
+	if err := yaml.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return []byte("{}"), nil
+	}
+
+	value, err := jsonValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// jsonValue YAMLから読み込んだ値を，キーが文字列のマップに置き換えてJSONで扱えるようにする
+func jsonValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			k, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("key %v is not a string", key)
+			}
+			converted, err := jsonValue(item)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = converted
+		}
+		return m, nil
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			converted, err := jsonValue(item)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = converted
+		}
+		return list, nil
+	default:
+		return v, nil
+	}
+}
+
+// loadEnv 環境変数が設定されていれば設定を上書きする
+func (c *Config) loadEnv() {
+	setFromEnv(&c.ChannelSecret, "CHANNEL_SECRET")
+	setFromEnv(&c.ChannelToken, "CHANNEL_TOKEN")
+	setFromEnv(&c.GCPAPIKey, "GCP_API")
+	setFromEnv(&c.Port, "PORT")
+	setFromEnv(&c.StorePath, "STORE_PATH")
+	setFromEnv(&c.PublicURL, "PUBLIC_URL")
+
+	if ids := os.Getenv("ADMIN_USER_IDS"); len(ids) > 0 {
+		c.AdminUserIDs = splitList(ids)
+	}
+}
+
+// validate 設定の不足や不正な値をまとめて返す
+func (c *Config) validate() error {
+	var problems []string
+
+	if len(c.ChannelSecret) == 0 {
+		problems = append(problems, "channel secret is not set (CHANNEL_SECRET)")
+	}
+	if len(c.ChannelToken) == 0 {
+		problems = append(problems, "channel token is not set (CHANNEL_TOKEN)")
+	}
+	if len(c.GCPAPIKey) == 0 {
+		problems = append(problems, "Google Maps API key is not set (GCP_API)")
+	}
+	if port, err := strconv.Atoi(c.Port); err != nil || port <= 0 || port > 65535 {
+		problems = append(problems, fmt.Sprintf("port %q is not a valid port number (PORT)", c.Port))
+	}
+	if c.PostbackTTL <= 0 {
+		problems = append(problems, "postbackTtl must be positive")
+	}
+	if c.RateLimit.Interval <= 0 || c.RateLimit.Burst <= 0 {
+		problems = append(problems, "rateLimit interval and burst must be positive")
+	}
+	if c.Alert.Interval <= 0 || c.Alert.Burst <= 0 {
+		problems = append(problems, "alert interval and burst must be positive")
+	}
+	if c.ReloadInterval < 0 {
+		problems = append(problems, "reloadInterval must not be negative")
+	}
+	if c.PageSize <= 0 || c.PageSize > maxPageSize {
+		problems = append(problems, fmt.Sprintf("pageSize must be between 1 and %d", maxPageSize))
+	}
+	for _, color := range []struct{ name, value string }{
+		{"rating", c.Theme.Rating},
+		{"label", c.Theme.Label},
+		{"text", c.Theme.Text},
+		{"open", c.Theme.Open},
+		{"closed", c.Theme.Closed},
+	} {
+		if !isHexColor(color.value) {
+			problems = append(problems, fmt.Sprintf("theme.%s %q is not a color such as #aaaaaa", color.name, color.value))
+		}
+	}
+	problems = append(problems, validateCategories(c.Categories)...)
+	problems = append(problems, validateGenders(c.Genders, c.Styles)...)
+	for i, radius := range c.RadiusOptions {
+		if radius == 0 || radius > 50000 {
+			problems = append(problems, fmt.Sprintf("radiusOptions[%d]: must be between 1 and 50000 meters", i))
+		}
+	}
+	problems = append(problems, validateCommands(c.Commands, c.Categories)...)
+	problems = append(problems, c.Ranking.validate(c.Categories)...)
+	problems = append(problems, c.Travel.validate()...)
+	problems = append(problems, c.Geocode.validate()...)
+	problems = append(problems, c.Expansion.validate()...)
+	if len(c.PublicURL) > 0 && !strings.HasPrefix(c.PublicURL, "https://") {
+		problems = append(problems, fmt.Sprintf("publicUrl %q must start with https:// (PUBLIC_URL)", c.PublicURL))
+	}
+	if len(c.StorePath) == 0 {
+		problems = append(problems, "storePath is not set")
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid config:\n  " + strings.Join(problems, "\n  "))
+	}
+
+	return nil
+}
+
+// checkCredentials LINEとGoogle Maps APIの認証情報が使えるか確認する
+func checkCredentials(bot *linebot.Client) error {
+	info, err := bot.GetBotInfo().Do()
+	if err != nil {
+		return fmt.Errorf("LINE credentials check failed, verify CHANNEL_SECRET and CHANNEL_TOKEN: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := Client.Geocode(ctx, &maps.GeocodingRequest{Address: "東京駅", Language: "ja"}); err != nil {
+		return fmt.Errorf("Google Maps credentials check failed, verify GCP_API: %v", err)
+	}
+
+	log.Printf("logged in as %s (%s)", info.DisplayName, info.UserID)
+
+	return nil
+}
+
+// isHexColor "#rrggbb" 形式の色か判定する
+func isHexColor(color string) bool {
+	if len(color) != 7 || color[0] != '#' {
+		return false
+	}
+	_, err := strconv.ParseUint(color[1:], 16, 32)
+	return err == nil
+}
+
+// setFromEnv 環境変数が空でなければ値を上書きする
+func setFromEnv(value *string, key string) {
+	if env := os.Getenv(key); len(env) > 0 {
+		*value = env
+	}
+}
+
+// splitList カンマ区切りの文字列を空要素を除いて分割する
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
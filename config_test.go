@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"config.json": `{
+  "port": "9000",
+  "adminUserIds": ["U1", "U2"],
+  "postbackTtl": "1h",
+  "pageSize": 5,
+  "rateLimit": {"interval": "2s", "burst": 3},
+  "theme": {"open": "#00ff00"}
+}`,
+		"config.yaml": `
+port: "9000"
+adminUserIds:
+  - U1
+  - U2
+postbackTtl: 1h
+pageSize: 5
+rateLimit:
+  interval: 2s
+  burst: 3
+theme:
+  open: "#00ff00"
+`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fromJSON := defaultConfig()
+	if err := fromJSON.loadFile(filepath.Join(dir, "config.json")); err != nil {
+		t.Fatal(err)
+	}
+	fromYAML := defaultConfig()
+	if err := fromYAML.loadFile(filepath.Join(dir, "config.yaml")); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(fromJSON, fromYAML) {
+		t.Errorf("YAML config = %+v, want %+v", fromYAML, fromJSON)
+	}
+	if fromYAML.Port != "9000" || fromYAML.PageSize != 5 || time.Duration(fromYAML.PostbackTTL) != time.Hour {
+		t.Errorf("YAML config was not applied: %+v", fromYAML)
+	}
+	if fromYAML.Theme.Open != "#00ff00" || fromYAML.Theme.Closed != defaultConfig().Theme.Closed {
+		t.Errorf("YAML theme = %+v, want only open to be overridden", fromYAML.Theme)
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "unknown.yml", content: "prot: \"9000\"\n", want: "unknown field"},
+		{name: "broken.yaml", content: "port: [\n", want: "yaml"},
+		{name: "config.toml", content: "port = 9000\n", want: "unknown file type"},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		if err := ioutil.WriteFile(path, []byte(tt.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		conf := defaultConfig()
+		err := conf.loadFile(path)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("loadFile(%s) = %v, want an error containing %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"googlemaps.github.io/maps"
+)
+
+// placeMapZoom 場所の確認に表示する地図の縮尺
+const placeMapZoom = 15
+
+// placeMapRequest 1つの場所を中心にした地図のリクエストを構築する
+func placeMapRequest(location []float64) *maps.StaticMapRequest {
+	point := maps.LatLng{Lat: location[0], Lng: location[1]}
+
+	return &maps.StaticMapRequest{
+		Center:   fmt.Sprintf("%f,%f", point.Lat, point.Lng),
+		Zoom:     placeMapZoom,
+		Size:     "600x400",
+		Scale:    2,
+		Language: "ja",
+		Markers: []maps.Marker{
+			{Color: "red", Location: []maps.LatLng{point}},
+		},
+	}
+}
+
+// confirmPlaceMessage 見つかった場所の住所と地図を示し，この場所で検索するか確認するメッセージを構築する
+func confirmPlaceMessage(conf *Config, name string, candidate PlaceCandidate) linebot.SendingMessage {
+	bubble := &Bubble{
+		Type: typeBubble,
+		Body: &Box{
+			Type:    typeBox,
+			Layout:  layoutVertical,
+			Spacing: sizeSm,
+			Contents: []ContentsContainer{
+				&Text{
+					Type:   typeText,
+					Text:   "この場所で検索しますか？",
+					Size:   sizeMd,
+					Weight: "bold",
+				},
+				&Text{
+					Type:   typeText,
+					Text:   candidate.label() + "・" + candidate.Kind,
+					Margin: sizeMd,
+					Size:   sizeSm,
+					Wrap:   true,
+					Color:  conf.Theme.Text,
+				},
+				&Text{
+					Type:  typeText,
+					Text:  candidate.Address,
+					Size:  sizeSm,
+					Wrap:  true,
+					Color: conf.Theme.Label,
+				},
+			},
+		},
+		Footer: &Box{
+			Type:    typeBox,
+			Layout:  layoutVertical,
+			Spacing: sizeSm,
+			Contents: []ContentsContainer{
+				buildPostbackActionButtonComponent("この場所で検索", placePostback(actionConfirmPlace, name, candidate.Location, candidate.Bounds)),
+				buildPostbackActionButtonComponent("場所を変更", PostbackData{Action: actionChangeLocation}),
+				buildPostbackActionButtonComponent("今後は確認しない", placePostback(actionSkipConfirm, name, candidate.Location, candidate.Bounds)),
+			},
+		},
+	}
+
+	if mapURL := mapImages.add(conf.PublicURL, placeMapRequest(candidate.Location)); len(mapURL) > 0 {
+		bubble.Header = &Box{
+			Type:       typeBox,
+			Layout:     layoutVertical,
+			PaddingAll: "0px",
+			Contents: []ContentsContainer{
+				buildImageComponent(mapURL, "3:2"),
+			},
+		}
+	}
+
+	return toFlexMessage("検索する場所の確認: "+candidate.Address, &Carousel{
+		Type:     typeCarousel,
+		Contents: []*Bubble{bubble},
+	})
+}
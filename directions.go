@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"googlemaps.github.io/maps"
+)
+
+// directionsURL Google マップで経路を開くURL
+const directionsURL = "https://www.google.com/maps/dir/?api=1&"
+
+// maxRouteSteps 経路の要約に載せる手順の最大数
+const maxRouteSteps = 8
+
+// travelModes 経路で選べる移動手段
+var travelModes = []maps.Mode{maps.TravelModeWalking, maps.TravelModeTransit, maps.TravelModeDriving}
+
+// htmlTag 経路の案内文から取り除くHTMLタグ
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// travelMode プロフィールに保存された経路の移動手段を返す．選んでいなければ徒歩とする
+func (p UserProfile) travelMode() maps.Mode {
+	if isTravelMode(maps.Mode(p.TravelMode)) {
+		return maps.Mode(p.TravelMode)
+	}
+	return maps.TravelModeWalking
+}
+
+// isTravelMode 経路で選べる移動手段か判定する
+func isTravelMode(mode maps.Mode) bool {
+	for _, m := range travelModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// routePostback 経路の要約を求めるポストバックデータを返す．後から別の検索をしても同じ経路を返せるよう，検索地点と移動手段も含める．
+// 検索地点は経路の検索に渡す精度(小数点以下6桁)に丸め，ポストバックの長さを抑える
+func routePostback(origin []float64, placeID string, mode maps.Mode) PostbackData {
+	return PostbackData{
+		Action:   actionRoute,
+		PlaceID:  placeID,
+		Location: roundCoordinates(origin),
+		Filters:  map[string]string{"mode": string(mode)},
+	}
+}
+
+// buildDirectionsURL 検索地点から店までの経路を Google マップで開くURLを返す．検索地点がなければ現在地からの経路になる
+func buildDirectionsURL(origin []float64, shopDetail maps.PlaceDetailsResult, mode maps.Mode) string {
+	values := url.Values{}
+	if len(origin) > 0 {
+		values.Set("origin", fmt.Sprintf("%f,%f", origin[0], origin[1]))
+	}
+	values.Set("destination", shopDetail.Name)
+	values.Set("destination_place_id", shopDetail.PlaceID)
+	values.Set("travelmode", string(mode))
+
+	return directionsURL + values.Encode()
+}
+
+// routeSummary Directions API で検索地点から店までの経路を取得し，短い文章にまとめる
+func routeSummary(origin []float64, placeID string, mode maps.Mode) (string, error) {
+	request := &maps.DirectionsRequest{
+		Origin:      fmt.Sprintf("%f,%f", origin[0], origin[1]),
+		Destination: "place_id:" + placeID,
+		Mode:        mode,
+		Language:    "ja",
+	}
+	if mode == maps.TravelModeTransit {
+		request.DepartureTime = "now"
+	}
+
+	routes, _, err := Client.Directions(context.Background(), request)
+	if err != nil {
+		return "", err
+	}
+	if len(routes) == 0 || len(routes[0].Legs) == 0 {
+		return "", errors.New("no route found")
+	}
+
+	leg := routes[0].Legs[0]
+	lines := []string{
+		fmt.Sprintf("%sで%d分 (%s)", modeName(mode), int(math.Ceil(leg.Duration.Minutes())), formatDistance(uint(leg.Distance.Meters))),
+	}
+	for i, step := range leg.Steps {
+		if i == maxRouteSteps {
+			lines = append(lines, "…")
+			break
+		}
+		lines = append(lines, fmt.Sprintf("%d. %s", i+1, describeStep(step)))
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// describeStep 経路の手順を1行で表す．電車・バスでは路線と乗り降りする駅を表す
+func describeStep(step *maps.Step) string {
+	if details := step.TransitDetails; details != nil {
+		line := details.Line.ShortName
+		if len(line) == 0 {
+			line = details.Line.Name
+		}
+		return fmt.Sprintf("%s %s → %s (%d駅)", line, details.DepartureStop.Name, details.ArrivalStop.Name, details.NumStops)
+	}
+
+	return fmt.Sprintf("%s (%s)", htmlTag.ReplaceAllString(step.HTMLInstructions, ""), formatDistance(uint(step.Distance.Meters)))
+}
+
+// travelModeQuickReplies 経路の移動手段を選ぶクイックリプライを構築する
+func travelModeQuickReplies(current maps.Mode) *linebot.QuickReplyItems {
+	var buttons []*linebot.QuickReplyButton
+	for _, mode := range travelModes {
+		buttons = append(buttons, postbackQuickReply(checkLabel(modeName(mode), mode == current), PostbackData{
+			Action:  actionTravelMode,
+			Filters: map[string]string{"mode": string(mode)},
+		}))
+	}
+
+	return quickReplyItems(buttons...)
+}
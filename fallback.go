@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"googlemaps.github.io/maps"
+)
+
+// ExpansionConfig 検索結果が少ないときに検索範囲を広げる設定
+type ExpansionConfig struct {
+	Radii      []uint `json:"radii"`
+	MinResults int    `json:"minResults"`
+	// MaxSteps 1回の検索で範囲を広げる最大回数
+	MaxSteps int `json:"maxSteps"`
+	// Timeout 最初の検索からこの時間を過ぎたら範囲を広げない．返信トークンが切れる前に結果を返すため
+	Timeout Duration `json:"timeout"`
+}
+
+// defaultExpansionConfig 検索範囲を広げる設定の既定値
+func defaultExpansionConfig() ExpansionConfig {
+	return ExpansionConfig{
+		Radii:      []uint{1000, 3000, 10000, 30000},
+		MinResults: 3,
+		MaxSteps:   2,
+		Timeout:    Duration(10 * time.Second),
+	}
+}
+
+// effectiveRadius 実際に検索する半径を返す．距離順で範囲を指定しない場合は制限がないため0を返す
+func (sr SearchRange) effectiveRadius() uint {
+	if sr.Radius == 0 && (sr.RankBy == rankByProminence || sr.RankBy == rankByScore) {
+		return defaultProminenceRadius
+	}
+	return sr.Radius
+}
+
+// next 今の検索範囲より一段広い半径を返す．これ以上広げられなければ false を返す
+func (ec ExpansionConfig) next(sr SearchRange) (uint, bool) {
+	current := sr.effectiveRadius()
+	if current == 0 {
+		return 0, false
+	}
+	for _, radius := range ec.Radii {
+		if radius > current {
+			return radius, true
+		}
+	}
+	return 0, false
+}
+
+// allows 検索範囲をもう一段広げてよいか判定する．エリアとスコア順の検索は1回で多くのAPIを呼ぶため広げない
+func (ec ExpansionConfig) allows(query SearchQuery, step int, started time.Time) bool {
+	if query.isAreaSearch() || query.Range.RankBy == rankByScore {
+		return false
+	}
+	return step < ec.MaxSteps && time.Since(started) < time.Duration(ec.Timeout)
+}
+
+// countShops 検索結果の店の数を返す
+func countShops(shops [][]maps.PlacesSearchResult) int {
+	count := 0
+	for _, page := range shops {
+		count += len(page)
+	}
+	return count
+}
+
+// noResultMessage 店が見つからなかったときに，近い種類や最寄りで店がある町を提案するメッセージを構築する
+func noResultMessage(conf *Config, query SearchQuery, categories []CategoryConfig, keywords []string) linebot.SendingMessage {
+	text := "条件に合うお店が見つかりませんでした"
+	if radius := query.Range.effectiveRadius(); radius > 0 && !query.isAreaSearch() {
+		text = formatDistance(radius) + "以内に" + text
+	}
+
+	var buttons []*linebot.QuickReplyButton
+	if town, ok := nearestTown(query, categories[0], keywords[0]); ok {
+		text += fmt.Sprintf("\n最寄りでは%s(約%s先)にあります", town.Name, formatDistance(town.meters))
+		buttons = append(buttons, postbackQuickReply(town.Name+"で探す", placePostback(actionPlaceCandidate, town.Name, town.Location, nil)))
+	}
+
+	related := relatedCategories(conf.Categories, categories)
+	if len(related) > 0 {
+		text += "\n近い種類のお店も探せます"
+	}
+	for _, category := range related {
+		if len(buttons) == maxQuickReplyItems-2 {
+			break
+		}
+		buttons = append(buttons, postbackQuickReply(category.Name+"を探す", PostbackData{
+			Action:   actionCategory,
+			Category: category.Key,
+		}))
+	}
+	if query.Filters.narrows() {
+		text += "\n絞り込みを外すと見つかるかもしれません"
+		buttons = append(buttons, postbackQuickReply("絞り込み", PostbackData{Action: actionFilterMenu}))
+	}
+	buttons = append(buttons, postbackQuickReply("場所を変更", PostbackData{Action: actionChangeLocation}))
+
+	return linebot.NewTextMessage(text).WithQuickReplies(quickReplyItems(buttons...))
+}
+
+// town 店が見つかった最寄りの町
+type town struct {
+	Name     string
+	Location []float64
+	meters   uint
+}
+
+// nearestTown 範囲を限らずに最も近い店を探し，その店がある町の名前と位置を返す
+func nearestTown(query SearchQuery, category CategoryConfig, keyword string) (town, bool) {
+	townQuery := query
+	townQuery.Category = category
+	townQuery.Bounds = nil
+	townQuery.Range = SearchRange{RankBy: rankByDistance}
+
+	shops, _, err := searchPlaces(nearbySearchRequest(townQuery, category, keyword), townQuery)
+	if err != nil {
+		log.Printf("nearest %s search failed: %v", category.Key, err)
+		return town{}, false
+	}
+	if len(shops) == 0 {
+		return town{}, false
+	}
+
+	shop := shops[0]
+	location := []float64{shop.Geometry.Location.Lat, shop.Geometry.Location.Lng}
+	name, err := areaName(location)
+	if err != nil {
+		log.Printf("reverse geocoding %v failed: %v", location, err)
+	}
+	if len(name) == 0 {
+		name = shop.Vicinity
+	}
+
+	return town{
+		Name:     name,
+		Location: location,
+		meters:   uint(distance(query.Origin, shop.Geometry.Location)),
+	}, true
+}
+
+// relatedCategories 検索した種類と同じグループの他の種類を返す
+func relatedCategories(all []CategoryConfig, searched []CategoryConfig) []CategoryConfig {
+	groups := map[string]bool{}
+	for _, category := range searched {
+		groups[category.groupName()] = true
+	}
+
+	var related []CategoryConfig
+	for _, category := range all {
+		if groups[category.groupName()] && !containsCategory(searched, category.Key) {
+			related = append(related, category)
+		}
+	}
+	return related
+}
+
+// validate 検索範囲を広げる設定の問題点を返す
+func (ec ExpansionConfig) validate() []string {
+	var problems []string
+	for i, radius := range ec.Radii {
+		if radius == 0 || radius > 50000 || (i > 0 && radius <= ec.Radii[i-1]) {
+			problems = append(problems, "expansion.radii must be increasing and between 1 and 50000 meters")
+			break
+		}
+	}
+	if ec.MinResults < 0 {
+		problems = append(problems, "expansion.minResults must not be negative")
+	}
+	if ec.MaxSteps < 0 {
+		problems = append(problems, "expansion.maxSteps must not be negative")
+	}
+	if ec.Timeout < 0 {
+		problems = append(problems, "expansion.timeout must not be negative")
+	}
+	return problems
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"googlemaps.github.io/maps"
+)
+
+const (
+	// maxFavorites ユーザごとに保存できるお気に入りの最大数
+	maxFavorites = 100
+	// favoritesPerPage お気に入りの一覧で1ページに表示する店の数．カルーセルの上限12件からページ送りの分を除く
+	favoritesPerPage = 10
+)
+
+// Favorite お気に入りに保存した店
+type Favorite struct {
+	PlaceID      string    `json:"placeId"`
+	Name         string    `json:"name"`
+	Vicinity     string    `json:"vicinity,omitempty"`
+	LocationName string    `json:"locationName,omitempty"`
+	AddedAt      time.Time `json:"addedAt"`
+
+	List string   `json:"list,omitempty"`
+	Tags []string `json:"tags,omitempty"`
+	Note string   `json:"note,omitempty"`
+}
+
+// favoritesByPlaceID お気に入りを店のIDで引けるようにする．検索結果のバブルにメモを表示するために使う
+func (p *UserProfile) favoritesByPlaceID() map[string]Favorite {
+	favorites := map[string]Favorite{}
+	for _, favorite := range p.Favorites {
+		favorites[favorite.PlaceID] = favorite
+	}
+	return favorites
+}
+
+// favorite お気に入りに保存した店を返す
+func (p *UserProfile) favorite(placeID string) (Favorite, bool) {
+	for _, favorite := range p.Favorites {
+		if favorite.PlaceID == placeID {
+			return favorite, true
+		}
+	}
+	return Favorite{}, false
+}
+
+// addFavorite お気に入りの先頭に店を加える．既に保存済みか上限に達していれば false を返す
+func (p *UserProfile) addFavorite(favorite Favorite) bool {
+	if _, ok := p.favorite(favorite.PlaceID); ok || len(p.Favorites) >= maxFavorites {
+		return false
+	}
+	p.Favorites = append([]Favorite{favorite}, p.Favorites...)
+	return true
+}
+
+// removeFavorite お気に入りから店を外す．保存されていなければ false を返す
+func (p *UserProfile) removeFavorite(placeID string) bool {
+	var favorites []Favorite
+	for _, favorite := range p.Favorites {
+		if favorite.PlaceID != placeID {
+			favorites = append(favorites, favorite)
+		}
+	}
+	removed := len(favorites) < len(p.Favorites)
+	p.Favorites = favorites
+	return removed
+}
+
+// favoritesPage お気に入りの指定したページに表示する店と，次のページがあるかを返す
+func favoritesPage(favorites []Favorite, page int) ([]Favorite, bool) {
+	start := page * favoritesPerPage
+	if page < 0 || start >= len(favorites) {
+		return nil, false
+	}
+	end := start + favoritesPerPage
+	if end >= len(favorites) {
+		return favorites[start:], false
+	}
+	return favorites[start:end], true
+}
+
+// getFavoriteBubbles お気に入りの店の最新の情報を取得し，バブルを構築する．ページ送りのバブルも加える
+func getFavoriteBubbles(conf *Config, favorites []Favorite, page int, hasNext bool, filters map[string]string, mode maps.Mode) []*Bubble {
+	var bubbles = make([]*Bubble, len(favorites))
+	bubbleChannel := make(chan BubbleData, len(favorites))
+	defer close(bubbleChannel)
+
+	for index, favorite := range favorites {
+		go func(index int, favorite Favorite) {
+			getFavoriteBubbleData(conf, bubbleChannel, index, favorite, mode)
+		}(index, favorite)
+	}
+
+	for range favorites {
+		bubble := <-bubbleChannel
+		bubbles[bubble.ID] = bubble.Bubble
+	}
+	bubbles = removeNilBubbles(bubbles)
+
+	if page > 0 || hasNext {
+		bubbles = append(bubbles, getFavoritesPageBubble(page, hasNext, filters))
+	}
+
+	return bubbles
+}
+
+// getFavoriteBubbleData お気に入りの店のバブルを構築してチャネルに送る．情報を取得できない店は外せるよう簡易なバブルにする
+func getFavoriteBubbleData(conf *Config, bubbleChannel chan BubbleData, index int, favorite Favorite, mode maps.Mode) {
+	defer recoverJob("getFavoriteBubbleData", func() {
+		bubbleChannel <- BubbleData{ID: index}
+	})
+
+	shopDetail, err := getPlaceDetails(favorite.PlaceID)
+	if err != nil {
+		log.Printf("details of favorite %s failed: %v", favorite.PlaceID, err)
+		bubbleChannel <- BubbleData{
+			ID:     index,
+			Bubble: getUnavailableFavoriteBubble(favorite, conf.Theme),
+		}
+		return
+	}
+
+	photo := getPlacePhotos(conf.GCPAPIKey, shopDetail.Photos)
+	query := SearchQuery{Favorites: map[string]Favorite{favorite.PlaceID: favorite}}
+	bubble := getBubble(shopDetail, photo, conf, query, Travel{}, "")
+	bubble.Body.Contents = append(bubble.Body.Contents, buildFavoriteSavedText(favorite, conf.Theme))
+	bubble.Footer = buildFavoriteBubbleFooter(shopDetail, mode)
+	bubbleChannel <- BubbleData{
+		ID:     index,
+		Bubble: bubble,
+	}
+}
+
+// buildFavoriteSavedText お気に入りに保存した日付と，保存したときの検索地点を構築
+func buildFavoriteSavedText(favorite Favorite, theme ThemeConfig) *Text {
+	text := favorite.AddedAt.In(jst).Format("2006/01/02") + "に保存"
+	if len(favorite.LocationName) > 0 {
+		text = favorite.LocationName + "で" + text
+	}
+
+	return &Text{
+		Type:   typeText,
+		Text:   text,
+		Margin: sizeMd,
+		Size:   sizeXs,
+		Wrap:   true,
+		Color:  theme.Label,
+	}
+}
+
+// buildFavoriteBubbleFooter お気に入りの一覧のフッターを構築．検索地点がないため経路は現在地から開く
+func buildFavoriteBubbleFooter(shopDetail maps.PlaceDetailsResult, mode maps.Mode) *Box {
+	contents := []ContentsContainer{
+		buildURIActionButtonComponent(buildDirectionsURL(nil, shopDetail, mode), "ここへ行く"),
+	}
+	contents = append(contents, buildShopLinkButtons(shopDetail)...)
+	contents = append(contents,
+		buildPostbackActionButtonComponent("リスト・メモ", PostbackData{Action: actionFavoriteMenu, PlaceID: shopDetail.PlaceID}),
+		buildPostbackActionButtonComponent("お気に入りから外す", PostbackData{Action: actionRemoveFavorite, PlaceID: shopDetail.PlaceID}),
+		&Spacer{
+			Type: typeSpacer,
+			Size: sizeSm,
+		},
+	)
+
+	return &Box{
+		Type:     typeBox,
+		Layout:   layoutVertical,
+		Spacing:  sizeSm,
+		Contents: contents,
+	}
+}
+
+// getUnavailableFavoriteBubble 情報を取得できなかったお気に入りの店のバブルを返す
+func getUnavailableFavoriteBubble(favorite Favorite, theme ThemeConfig) *Bubble {
+	return &Bubble{
+		Type: typeBubble,
+		Body: &Box{
+			Type:   typeBox,
+			Layout: layoutVertical,
+			Contents: []ContentsContainer{
+				&Text{
+					Type:   typeText,
+					Text:   favorite.Name,
+					Size:   sizeLg,
+					Wrap:   true,
+					Weight: "bold",
+				},
+				&Text{
+					Type:   typeText,
+					Text:   "お店の情報を取得できませんでした．閉店した可能性があります",
+					Margin: sizeMd,
+					Size:   sizeSm,
+					Wrap:   true,
+					Color:  theme.Closed,
+				},
+				buildFavoriteSavedText(favorite, theme),
+			},
+		},
+		Footer: &Box{
+			Type:   typeBox,
+			Layout: layoutVertical,
+			Contents: []ContentsContainer{
+				buildPostbackActionButtonComponent("お気に入りから外す", PostbackData{Action: actionRemoveFavorite, PlaceID: favorite.PlaceID}),
+			},
+		},
+	}
+}
+
+// getFavoritesPageBubble お気に入りの前後のページを表示するバブルを返す
+func getFavoritesPageBubble(page int, hasNext bool, filters map[string]string) *Bubble {
+	var contents []ContentsContainer
+	if hasNext {
+		contents = append(contents, buildPostbackActionButtonComponent("次のページ", PostbackData{Action: actionFavorites, Page: page + 1, Filters: filters}))
+	}
+	if page > 0 {
+		contents = append(contents, buildPostbackActionButtonComponent("前のページ", PostbackData{Action: actionFavorites, Page: page - 1, Filters: filters}))
+	}
+
+	return &Bubble{
+		Type: typeBubble,
+		Body: &Box{
+			Type:     typeBox,
+			Layout:   layoutVertical,
+			Contents: contents,
+		},
+	}
+}
+
+// favoritesAltText お気に入りの一覧の代替テキストを返す
+func favoritesAltText(total int, page int, filters map[string]string) string {
+	pages := (total + favoritesPerPage - 1) / favoritesPerPage
+	title := "お気に入り"
+	if filter := describeFavoriteFilters(filters); len(filter) > 0 {
+		title += " " + filter
+	}
+	return fmt.Sprintf("%s %d件 (%d/%dページ)", title, total, page+1, pages)
+}
+
+// noFavoritesMessage お気に入りがないときのメッセージを返す
+func noFavoritesMessage(searchData *SearchData, recent []RecentPlace) linebot.SendingMessage {
+	return linebot.NewTextMessage("お気に入りはまだありません．検索結果の「お気に入りに追加」から保存できます").WithQuickReplies(promptQuickReplies(searchData, recent))
+}
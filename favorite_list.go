@@ -0,0 +1,219 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+const (
+	// maxListNameLength リスト名とタグの最大文字数．ポストバックとクイックリプライに収まる長さにする
+	maxListNameLength = 20
+	// maxNoteLength お気に入りに書けるメモの最大文字数
+	maxNoteLength = 100
+	// maxTags お気に入り1件に付けられるタグの最大数
+	maxTags = 5
+	// noList リストに入れていないお気に入りの表示名
+	noList = "未分類"
+)
+
+// 待っているテキスト入力の種類
+const (
+	inputListName = "list"
+	inputNote     = "note"
+)
+
+// PendingInput 次のテキストメッセージで受け取る入力．リスト名やメモのように自由な言葉を受け取るときに使う
+type PendingInput struct {
+	Kind    string
+	PlaceID string
+}
+
+// favoriteLists お気に入りのリスト名を返す．リストは店を入れたときにでき，店がなくなると消える
+func (p *UserProfile) favoriteLists() []string {
+	var lists []string
+	for _, favorite := range p.Favorites {
+		if len(favorite.List) > 0 && !contains(lists, favorite.List) {
+			lists = append(lists, favorite.List)
+		}
+	}
+	sort.Strings(lists)
+	return lists
+}
+
+// favoriteTags お気に入りに付けたタグを返す
+func (p *UserProfile) favoriteTags() []string {
+	var tags []string
+	for _, favorite := range p.Favorites {
+		for _, tag := range favorite.Tags {
+			if !contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// updateFavorite 保存したお気に入りを変更する．保存されていなければ false を返す
+func (p *UserProfile) updateFavorite(placeID string, update func(favorite *Favorite)) bool {
+	for i := range p.Favorites {
+		if p.Favorites[i].PlaceID == placeID {
+			update(&p.Favorites[i])
+			return true
+		}
+	}
+	return false
+}
+
+// filterFavorites リスト名かタグでお気に入りを絞り込む．条件が空であれば全て返す
+func filterFavorites(favorites []Favorite, filters map[string]string) []Favorite {
+	list, byList := filters["list"]
+	tag, byTag := filters["tag"]
+
+	var filtered []Favorite
+	for _, favorite := range favorites {
+		if byList && favorite.List != list {
+			continue
+		}
+		if byTag && !contains(favorite.Tags, tag) {
+			continue
+		}
+		filtered = append(filtered, favorite)
+	}
+	return filtered
+}
+
+// describeFavoriteFilters お気に入りの絞り込み条件の説明を返す．条件がなければ空文字を返す
+func describeFavoriteFilters(filters map[string]string) string {
+	if list, ok := filters["list"]; ok {
+		if len(list) == 0 {
+			return noList
+		}
+		return list
+	}
+	if tag, ok := filters["tag"]; ok {
+		return "#" + tag
+	}
+	return ""
+}
+
+// parseNote 送られたメモから「#」で始まる言葉をタグとして取り出し，残りをメモにする
+func parseNote(text string) (string, []string) {
+	var words, tags []string
+	for _, word := range strings.Fields(text) {
+		if !strings.HasPrefix(word, "#") && !strings.HasPrefix(word, "＃") {
+			words = append(words, word)
+			continue
+		}
+		tag := truncate(strings.TrimLeft(word, "#＃"), maxListNameLength)
+		if len(tag) > 0 && !contains(tags, tag) && len(tags) < maxTags {
+			tags = append(tags, tag)
+		}
+	}
+
+	return truncate(strings.Join(words, " "), maxNoteLength), tags
+}
+
+// validListName リスト名として使えるか判定する
+func validListName(name string) bool {
+	return len(name) > 0 && utf8.RuneCountInString(name) <= maxListNameLength && name != noList
+}
+
+// buildFavoriteNote お気に入りに書いたメモとタグを構築．どちらもなければ nil を返す
+func buildFavoriteNote(favorite Favorite, theme ThemeConfig) *Box {
+	var contents []ContentsContainer
+	if len(favorite.Note) > 0 {
+		contents = append(contents, &Text{
+			Type:  typeText,
+			Text:  "メモ: " + favorite.Note,
+			Size:  sizeSm,
+			Wrap:  true,
+			Color: theme.Text,
+		})
+	}
+	if len(favorite.Tags) > 0 {
+		contents = append(contents, &Text{
+			Type:  typeText,
+			Text:  "#" + strings.Join(favorite.Tags, " #"),
+			Size:  sizeXs,
+			Wrap:  true,
+			Color: theme.Label,
+		})
+	}
+	if len(contents) == 0 {
+		return nil
+	}
+
+	return &Box{
+		Type:     typeBox,
+		Layout:   layoutVertical,
+		Margin:   sizeMd,
+		Contents: contents,
+	}
+}
+
+// favoriteMenuQuickReplies お気に入りの店をリストに入れる，メモを書く操作のクイックリプライを構築する
+func favoriteMenuQuickReplies(profile UserProfile, favorite Favorite) *linebot.QuickReplyItems {
+	var buttons []*linebot.QuickReplyButton
+	for _, list := range profile.favoriteLists() {
+		if len(buttons) == maxQuickReplyItems-4 {
+			break
+		}
+		buttons = append(buttons, postbackQuickReply(checkLabel(list, favorite.List == list), PostbackData{
+			Action:  actionMoveFavorite,
+			PlaceID: favorite.PlaceID,
+			Name:    list,
+		}))
+	}
+	buttons = append(buttons,
+		postbackQuickReply(checkLabel(noList, len(favorite.List) == 0), PostbackData{Action: actionMoveFavorite, PlaceID: favorite.PlaceID}),
+		postbackQuickReply("新しいリスト", PostbackData{Action: actionNewList, PlaceID: favorite.PlaceID}),
+		postbackQuickReply("メモ・タグを書く", PostbackData{Action: actionEditNote, PlaceID: favorite.PlaceID}),
+	)
+	if len(favorite.Note) > 0 || len(favorite.Tags) > 0 {
+		buttons = append(buttons, postbackQuickReply("メモ・タグを消す", PostbackData{Action: actionClearNote, PlaceID: favorite.PlaceID}))
+	}
+
+	return quickReplyItems(buttons...)
+}
+
+// favoriteFilterQuickReplies お気に入りをリストやタグで絞り込むクイックリプライを構築する．リストもタグもなければ nil を返す
+func favoriteFilterQuickReplies(profile UserProfile, current map[string]string) *linebot.QuickReplyItems {
+	lists := profile.favoriteLists()
+	tags := profile.favoriteTags()
+	if len(lists) == 0 && len(tags) == 0 {
+		return nil
+	}
+
+	buttons := []*linebot.QuickReplyButton{
+		postbackQuickReply(checkLabel("すべて", len(current) == 0), PostbackData{Action: actionFavorites}),
+	}
+	for _, list := range append(lists, noList) {
+		if len(buttons) == maxQuickReplyItems {
+			break
+		}
+		key := list
+		if list == noList {
+			key = ""
+		}
+		value, ok := current["list"]
+		buttons = append(buttons, postbackQuickReply(checkLabel(list, ok && value == key), PostbackData{
+			Action:  actionFavorites,
+			Filters: map[string]string{"list": key},
+		}))
+	}
+	for _, tag := range tags {
+		if len(buttons) == maxQuickReplyItems {
+			break
+		}
+		buttons = append(buttons, postbackQuickReply(checkLabel("#"+tag, current["tag"] == tag), PostbackData{
+			Action:  actionFavorites,
+			Filters: map[string]string{"tag": tag},
+		}))
+	}
+
+	return quickReplyItems(buttons...)
+}
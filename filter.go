@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"googlemaps.github.io/maps"
+)
+
+// 絞り込みの選択肢
+var (
+	ratingOptions = []float32{3.5, 4.0}
+	reviewOptions = []int{10, 50}
+)
+
+// businessStatusOperational 営業している店の business_status
+const businessStatusOperational = "OPERATIONAL"
+
+// ResultFilters 検索結果の絞り込み条件
+type ResultFilters struct {
+	MinRating     float32 `json:"minRating,omitempty"`
+	MinReviews    int     `json:"minReviews,omitempty"`
+	OpenNow       bool    `json:"openNow,omitempty"`
+	MinPrice      int     `json:"minPrice,omitempty"`
+	MaxPrice      int     `json:"maxPrice,omitempty"`
+	IncludeClosed bool    `json:"includeClosed,omitempty"`
+}
+
+// ShopFilter 検索結果に残す店であれば true を返す
+type ShopFilter func(shop maps.PlacesSearchResult) bool
+
+// shopFilters 絞り込み条件を個々のフィルタに分解する
+func (rf ResultFilters) shopFilters() []ShopFilter {
+	var filters []ShopFilter
+
+	if rf.MinRating > 0 {
+		filters = append(filters, func(shop maps.PlacesSearchResult) bool {
+			return shop.Rating >= rf.MinRating
+		})
+	}
+	if rf.MinReviews > 0 {
+		filters = append(filters, func(shop maps.PlacesSearchResult) bool {
+			return shop.UserRatingsTotal >= rf.MinReviews
+		})
+	}
+	if rf.OpenNow {
+		filters = append(filters, func(shop maps.PlacesSearchResult) bool {
+			return shop.OpeningHours != nil && shop.OpeningHours.OpenNow != nil && *shop.OpeningHours.OpenNow
+		})
+	}
+	if rf.MinPrice > 0 || rf.MaxPrice > 0 {
+		filters = append(filters, func(shop maps.PlacesSearchResult) bool {
+			// 価格帯が登録されていない店は除かない
+			if shop.PriceLevel == 0 {
+				return true
+			}
+			return shop.PriceLevel >= rf.MinPrice && (rf.MaxPrice == 0 || shop.PriceLevel <= rf.MaxPrice)
+		})
+	}
+	if !rf.IncludeClosed {
+		filters = append(filters, func(shop maps.PlacesSearchResult) bool {
+			return !shop.PermanentlyClosed && (len(shop.BusinessStatus) == 0 || shop.BusinessStatus == businessStatusOperational)
+		})
+	}
+
+	return filters
+}
+
+// apply 検索APIで絞り込める条件をリクエストに反映する．価格帯は渡すと登録されていない店まで除かれるため，shopFilters でのみ絞り込む
+func (rf ResultFilters) apply(request *maps.NearbySearchRequest) {
+	request.OpenNow = rf.OpenNow
+}
+
+// describe 絞り込み条件の説明を返す．条件がなければ空文字を返す
+func (rf ResultFilters) describe() string {
+	var parts []string
+	if rf.MinRating > 0 {
+		parts = append(parts, fmt.Sprintf("★%.1f以上", rf.MinRating))
+	}
+	if rf.MinReviews > 0 {
+		parts = append(parts, fmt.Sprintf("口コミ%d件以上", rf.MinReviews))
+	}
+	if rf.OpenNow {
+		parts = append(parts, "営業中のみ")
+	}
+	if rf.MinPrice > 0 || rf.MaxPrice > 0 {
+		parts = append(parts, describePrice(rf.MinPrice, rf.MaxPrice))
+	}
+	if rf.IncludeClosed {
+		parts = append(parts, "閉業店を含む")
+	}
+
+	return strings.Join(parts, " / ")
+}
+
+// narrows 検索結果を減らす絞り込み条件があるか判定する
+func (rf ResultFilters) narrows() bool {
+	return rf.MinRating > 0 || rf.MinReviews > 0 || rf.OpenNow || rf.MinPrice > 0 || rf.MaxPrice > 0
+}
+
+// describePrice 価格帯を「¥」の数で表す
+func describePrice(minPrice int, maxPrice int) string {
+	switch {
+	case maxPrice == 0:
+		return strings.Repeat("¥", minPrice) + "以上"
+	case minPrice == 0:
+		return strings.Repeat("¥", maxPrice) + "以下"
+	}
+	return strings.Repeat("¥", minPrice) + "〜" + strings.Repeat("¥", maxPrice)
+}
+
+// matchesAll 店が全てのフィルタを満たすか判定する
+func matchesAll(filters []ShopFilter, shop maps.PlacesSearchResult) bool {
+	for _, filter := range filters {
+		if !filter(shop) {
+			return false
+		}
+	}
+	return true
+}
+
+// excludeKeywords 店の種類の除外キーワードに当たる店を除くフィルタを返す
+func excludeKeywords(category CategoryConfig) ShopFilter {
+	return func(shop maps.PlacesSearchResult) bool {
+		return !category.excludes(shop)
+	}
+}
+
+// filterQuickReplies 絞り込み条件を切り替えるクイックリプライを構築する
+func filterQuickReplies(current ResultFilters) *linebot.QuickReplyItems {
+	var buttons []*linebot.QuickReplyButton
+
+	for _, rating := range ratingOptions {
+		buttons = append(buttons, filterQuickReply(fmt.Sprintf("★%.1f以上", rating), current.MinRating == rating, "rating", strconv.FormatFloat(float64(rating), 'f', 1, 32)))
+	}
+	for _, reviews := range reviewOptions {
+		buttons = append(buttons, filterQuickReply(fmt.Sprintf("口コミ%d件以上", reviews), current.MinReviews == reviews, "reviews", strconv.Itoa(reviews)))
+	}
+	buttons = append(buttons,
+		filterQuickReply("営業中のみ", current.OpenNow, "open", "true"),
+		filterQuickReply("¥¥以下", current.MinPrice == 0 && current.MaxPrice == 2, "price", "0-2"),
+		filterQuickReply("¥¥¥以上", current.MinPrice == 3 && current.MaxPrice == 0, "price", "3-0"),
+		filterQuickReply("閉業店も表示", current.IncludeClosed, "closed", "true"),
+		postbackQuickReply("条件をクリア", PostbackData{Action: actionClearFilters}),
+	)
+
+	return quickReplyItems(buttons...)
+}
+
+// filterQuickReply 絞り込み条件を1つ切り替えるクイックリプライのボタンを構築する
+func filterQuickReply(label string, checked bool, key string, value string) *linebot.QuickReplyButton {
+	return postbackQuickReply(checkLabel(label, checked), PostbackData{
+		Action:  actionFilter,
+		Filters: map[string]string{key: value},
+	})
+}
+
+// toggle 絞り込み条件を1つ切り替える．選択中の条件を選んだ場合は外す
+func (rf *ResultFilters) toggle(key string, value string) error {
+	switch key {
+	case "rating":
+		rating, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return err
+		}
+		if rf.MinRating == float32(rating) {
+			rf.MinRating = 0
+		} else {
+			rf.MinRating = float32(rating)
+		}
+
+	case "reviews":
+		reviews, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		if rf.MinReviews == reviews {
+			rf.MinReviews = 0
+		} else {
+			rf.MinReviews = reviews
+		}
+
+	case "open":
+		rf.OpenNow = !rf.OpenNow
+
+	case "price":
+		var minPrice, maxPrice int
+		if _, err := fmt.Sscanf(value, "%d-%d", &minPrice, &maxPrice); err != nil {
+			return err
+		}
+		if rf.MinPrice == minPrice && rf.MaxPrice == maxPrice {
+			rf.MinPrice, rf.MaxPrice = 0, 0
+		} else {
+			rf.MinPrice, rf.MaxPrice = minPrice, maxPrice
+		}
+
+	case "closed":
+		rf.IncludeClosed = !rf.IncludeClosed
+
+	default:
+		return fmt.Errorf("unknown filter %q", key)
+	}
+
+	return nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"math"
+
+	"googlemaps.github.io/maps"
+)
+
+// earthRadius 地球の半径（メートル）
+const earthRadius = 6371000
+
+// distance 検索地点から店までの直線距離（メートル）を返す
+func distance(origin []float64, point maps.LatLng) float64 {
+	lat1 := origin[0] * math.Pi / 180
+	lat2 := point.Lat * math.Pi / 180
+	dLat := lat2 - lat1
+	dLng := (point.Lng - origin[1]) * math.Pi / 180
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"googlemaps.github.io/maps"
+)
+
+const (
+	// maxPlaceCandidates 場所の候補として示す最大数
+	maxPlaceCandidates = 5
+	// nearbyStationRadius 位置情報の名前に添える最寄り駅を探す範囲（メートル）
+	nearbyStationRadius = 1500
+	// locationTypeApproximate 検索結果の位置が大まかにしか分からないことを表す LocationType
+	locationTypeApproximate = "APPROXIMATE"
+)
+
+// areaComponentTypes 位置情報の名前に使う住所の要素．広い順に並べる．日本の住所では level_2 が町名，level_3 が丁目，level_4 が番や字になる
+var areaComponentTypes = []string{"locality", "sublocality_level_1", "sublocality_level_2", "sublocality_level_3", "sublocality_level_4"}
+
+// GeocodeConfig 場所の名称を検索するときの地域の設定
+type GeocodeConfig struct {
+	Region  string `json:"region"`
+	Country string `json:"country"`
+}
+
+// PlaceCandidate 場所の名称から見つかった候補
+type PlaceCandidate struct {
+	Name       string
+	Prefecture string
+	Kind       string
+	Address    string
+	Location   []float64
+	Bounds     []float64
+}
+
+// placeKinds 場所の種類の表記．先に書いたものを優先する
+var placeKinds = []struct {
+	placeType string
+	name      string
+}{
+	{"train_station", "駅"},
+	{"transit_station", "駅"},
+	{"airport", "空港"},
+	{"administrative_area_level_1", "都道府県"},
+	{"locality", "市区町村"},
+	{"ward", "区"},
+	{"sublocality", "地区"},
+	{"neighborhood", "地区"},
+	{"park", "公園"},
+	{"point_of_interest", "施設"},
+	{"establishment", "施設"},
+	{"premise", "建物"},
+	{"route", "道路"},
+}
+
+// defaultGeocodeConfig 場所の名称を検索するときの地域の設定の既定値
+func defaultGeocodeConfig() GeocodeConfig {
+	return GeocodeConfig{
+		Region:  "jp",
+		Country: "JP",
+	}
+}
+
+// geocode 場所の名称を検索し，候補を返す．候補が1つに絞れないときや，1つでも確かでないときは ambiguous を true にする
+func geocode(gc GeocodeConfig, term string) (candidates []PlaceCandidate, ambiguous bool, err error) {
+	request := &maps.GeocodingRequest{
+		Address:  term,
+		Language: "ja",
+		Region:   gc.Region,
+	}
+	if len(gc.Country) > 0 {
+		request.Components = map[maps.Component]string{maps.ComponentCountry: gc.Country}
+	}
+
+	results, err := Client.Geocode(context.Background(), request)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for i, result := range results {
+		if i == maxPlaceCandidates {
+			break
+		}
+		candidates = append(candidates, newPlaceCandidate(result))
+	}
+
+	return candidates, isAmbiguous(results), nil
+}
+
+// isAmbiguous 検索結果が複数あるか，1つでも一部だけの一致や大まかな位置しか分からないものであれば true を返す
+func isAmbiguous(results []maps.GeocodingResult) bool {
+	if len(results) != 1 {
+		return len(results) > 1
+	}
+	return results[0].PartialMatch || results[0].Geometry.LocationType == locationTypeApproximate
+}
+
+// newPlaceCandidate 検索結果から場所の候補を作る
+func newPlaceCandidate(result maps.GeocodingResult) PlaceCandidate {
+	candidate := PlaceCandidate{
+		Address:  result.FormattedAddress,
+		Kind:     placeKind(result.Types),
+		Location: []float64{result.Geometry.Location.Lat, result.Geometry.Location.Lng},
+		Bounds:   areaBounds(result),
+	}
+
+	for _, component := range result.AddressComponents {
+		if len(candidate.Name) == 0 {
+			candidate.Name = component.LongName
+		}
+		if contains(component.Types, "administrative_area_level_1") {
+			candidate.Prefecture = component.LongName
+		}
+	}
+	if len(candidate.Name) == 0 {
+		candidate.Name = result.FormattedAddress
+	}
+
+	return candidate
+}
+
+// placeKind 場所の種類を日本語で返す
+func placeKind(types []string) string {
+	for _, kind := range placeKinds {
+		if contains(types, kind.placeType) {
+			return kind.name
+		}
+	}
+	return "場所"
+}
+
+// label 候補を区別できるよう都道府県を添えた名称を返す
+func (pc PlaceCandidate) label() string {
+	if len(pc.Prefecture) == 0 || pc.Prefecture == pc.Name {
+		return pc.Name
+	}
+	return pc.Name + "(" + pc.Prefecture + ")"
+}
+
+// placeCandidatesMessage 場所の候補を選んでもらうメッセージを構築する
+func placeCandidatesMessage(term string, candidates []PlaceCandidate) linebot.SendingMessage {
+	lines := []string{fmt.Sprintf("「%s」に当てはまる場所が複数あります．検索する場所を選んで下さい", term)}
+	var buttons []*linebot.QuickReplyButton
+	for i, candidate := range candidates {
+		lines = append(lines, fmt.Sprintf("%d. %s・%s\n   %s", i+1, candidate.label(), candidate.Kind, candidate.Address))
+		buttons = append(buttons, postbackQuickReply(fmt.Sprintf("%d. %s", i+1, candidate.label()), placePostback(actionPlaceCandidate, candidate.label(), candidate.Location, candidate.Bounds)))
+	}
+	buttons = append(buttons, postbackQuickReply("場所を変更", PostbackData{Action: actionChangeLocation}))
+
+	return linebot.NewTextMessage(strings.Join(lines, "\n")).WithQuickReplies(quickReplyItems(buttons...))
+}
+
+// describeLocation 位置情報を「渋谷区神南1丁目 (渋谷駅付近)」のような短い名前にする．名前を作れなければ fallback を返す
+func describeLocation(location []float64, fallback string) string {
+	area, err := areaName(location)
+	if err != nil {
+		log.Printf("reverse geocoding %v failed: %v", location, err)
+	}
+	station, err := nearestStation(location)
+	if err != nil {
+		log.Printf("station search near %v failed: %v", location, err)
+	}
+
+	switch {
+	case len(area) > 0 && len(station) > 0:
+		return area + " (" + station + "付近)"
+	case len(area) > 0:
+		return area
+	case len(station) > 0:
+		return station + "付近"
+	}
+	return fallback
+}
+
+// areaName 逆ジオコーディングで位置の市区町村と町名を返す
+func areaName(location []float64) (string, error) {
+	results, err := Client.ReverseGeocode(context.Background(), &maps.GeocodingRequest{
+		LatLng:   &maps.LatLng{Lat: location[0], Lng: location[1]},
+		Language: "ja",
+	})
+	if err != nil || len(results) == 0 {
+		return "", err
+	}
+
+	return formatAreaName(results[0]), nil
+}
+
+// formatAreaName 住所の要素を広い順につなげ，「渋谷区神南1丁目」のような名前にする．番のような数字だけの要素は場所の名前には細かすぎるため除く
+func formatAreaName(result maps.GeocodingResult) string {
+	var parts []string
+	for _, componentType := range areaComponentTypes {
+		for _, component := range result.AddressComponents {
+			if contains(component.Types, componentType) {
+				if name := foldDigits(component.LongName); !isNumber(name) {
+					parts = append(parts, name)
+				}
+				break
+			}
+		}
+	}
+
+	return strings.Join(parts, "")
+}
+
+// foldDigits 全角の数字を半角にする
+func foldDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '０' && r <= '９' {
+			return r - '０' + '0'
+		}
+		return r
+	}, s)
+}
+
+// isNumber 半角の数字だけからなるか判定する
+func isNumber(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// nearestStation 位置から最も近い駅の名前を返す．近くに駅がなければ空文字を返す
+func nearestStation(location []float64) (string, error) {
+	response, err := Client.NearbySearch(context.Background(), &maps.NearbySearchRequest{
+		Location: &maps.LatLng{Lat: location[0], Lng: location[1]},
+		RankBy:   maps.RankByDistance,
+		Type:     maps.PlaceTypeTrainStation,
+		Language: "ja",
+	})
+	if err != nil || len(response.Results) == 0 {
+		return "", err
+	}
+
+	station := response.Results[0]
+	if distance(location, station.Geometry.Location) > nearbyStationRadius {
+		return "", nil
+	}
+	if !strings.HasSuffix(station.Name, "駅") {
+		return station.Name + "駅", nil
+	}
+	return station.Name, nil
+}
+
+// validate 地域の設定の問題点を返す
+func (gc GeocodeConfig) validate() []string {
+	var problems []string
+	if len(gc.Region) > 0 && len(gc.Region) != 2 {
+		problems = append(problems, fmt.Sprintf("geocode.region %q must be a two-letter ccTLD such as \"jp\"", gc.Region))
+	}
+	if len(gc.Country) > 0 && len(gc.Country) != 2 {
+		problems = append(problems, fmt.Sprintf("geocode.country %q must be a two-letter country code such as \"JP\"", gc.Country))
+	}
+	return problems
+}
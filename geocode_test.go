@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+
+	"googlemaps.github.io/maps"
+)
+
+func TestIsAmbiguous(t *testing.T) {
+	exact := maps.GeocodingResult{Geometry: maps.AddressGeometry{LocationType: "ROOFTOP"}}
+	partial := maps.GeocodingResult{PartialMatch: true, Geometry: maps.AddressGeometry{LocationType: "ROOFTOP"}}
+	approximate := maps.GeocodingResult{Geometry: maps.AddressGeometry{LocationType: "APPROXIMATE"}}
+
+	tests := []struct {
+		name    string
+		results []maps.GeocodingResult
+		want    bool
+	}{
+		{name: "no results", want: false},
+		{name: "one exact result", results: []maps.GeocodingResult{exact}, want: false},
+		{name: "one partial match", results: []maps.GeocodingResult{partial}, want: true},
+		{name: "one approximate result", results: []maps.GeocodingResult{approximate}, want: true},
+		{name: "several results", results: []maps.GeocodingResult{exact, exact}, want: true},
+	}
+
+	for _, tt := range tests {
+		if got := isAmbiguous(tt.results); got != tt.want {
+			t.Errorf("%s: isAmbiguous() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFormatAreaName(t *testing.T) {
+	component := func(name string, types ...string) maps.AddressComponent {
+		return maps.AddressComponent{LongName: name, Types: types}
+	}
+
+	tests := []struct {
+		name       string
+		components []maps.AddressComponent
+		want       string
+	}{
+		{
+			name: "tokyo ward",
+			components: []maps.AddressComponent{
+				component("１１", "premise"),
+				component("１９", "political", "sublocality", "sublocality_level_4"),
+				component("１丁目", "political", "sublocality", "sublocality_level_3"),
+				component("神南", "political", "sublocality", "sublocality_level_2"),
+				component("渋谷区", "locality", "political"),
+				component("東京都", "administrative_area_level_1", "political"),
+				component("日本", "country", "political"),
+			},
+			want: "渋谷区神南1丁目",
+		},
+		{
+			name: "ward of a city",
+			components: []maps.AddressComponent{
+				component("３", "political", "sublocality", "sublocality_level_4"),
+				component("３丁目", "political", "sublocality", "sublocality_level_3"),
+				component("梅田", "political", "sublocality", "sublocality_level_2"),
+				component("北区", "political", "sublocality", "sublocality_level_1", "ward"),
+				component("大阪市", "locality", "political"),
+			},
+			want: "大阪市北区梅田3丁目",
+		},
+		{
+			name: "named section",
+			components: []maps.AddressComponent{
+				component("向原", "political", "sublocality", "sublocality_level_4"),
+				component("大字上野", "political", "sublocality", "sublocality_level_2"),
+				component("軽井沢町", "locality", "political"),
+			},
+			want: "軽井沢町大字上野向原",
+		},
+		{
+			name:       "no area components",
+			components: []maps.AddressComponent{component("日本", "country", "political")},
+			want:       "",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := formatAreaName(maps.GeocodingResult{AddressComponents: tt.components}); got != tt.want {
+			t.Errorf("%s: formatAreaName() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
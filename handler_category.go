@@ -0,0 +1,70 @@
+package main
+
+import (
+	"log"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+func init() {
+	router.onPostback(actionCategory, handleCategoryPostback)
+	router.onPostback(actionToggleCategory, handleToggleCategoryPostback)
+	router.onPostback(actionSearchSelected, handleSearchSelectedPostback)
+	router.onPostback(actionPicker, handlePickerPostback)
+}
+
+// handleCategoryPostback 選ばれた店の種類を検索対象に設定する
+func handleCategoryPostback(ctx *EventContext) {
+	category, ok := ctx.Config.category(ctx.Postback.Category)
+	if !ok {
+		log.Printf("unknown category %q from %s", ctx.Postback.Category, ctx.userID())
+		ctx.reply(linebot.NewTextMessage("この種類は現在検索できません．もう一度選んで下さい"))
+		return
+	}
+
+	ctx.Session.SearchData.setCategories([]CategoryConfig{category})
+
+	continueSearch(ctx)
+}
+
+// handleToggleCategoryPostback 店の種類を複数選択に加える，または外し，選択状態を反映した一覧を返す
+func handleToggleCategoryPostback(ctx *EventContext) {
+	if _, ok := ctx.Config.category(ctx.Postback.Category); !ok {
+		log.Printf("unknown category %q from %s", ctx.Postback.Category, ctx.userID())
+		ctx.reply(linebot.NewTextMessage("この種類は現在検索できません．もう一度選んで下さい"))
+		return
+	}
+
+	searchData := ctx.Session.SearchData
+	if contains(searchData.Selected, ctx.Postback.Category) {
+		var selected []string
+		for _, key := range searchData.Selected {
+			if key != ctx.Postback.Category {
+				selected = append(selected, key)
+			}
+		}
+		searchData.Selected = selected
+	} else {
+		searchData.Selected = append(searchData.Selected, ctx.Postback.Category)
+	}
+
+	ctx.reply(categoryPickerMessage(ctx.Config.Categories, searchData.Selected, ctx.Postback.Page))
+}
+
+// handleSearchSelectedPostback 複数選択した店の種類を検索対象に設定する
+func handleSearchSelectedPostback(ctx *EventContext) {
+	categories := ctx.Config.categories(ctx.Session.SearchData.Selected)
+	if len(categories) == 0 {
+		ctx.reply(linebot.NewTextMessage("店の種類が選ばれていません．「＋」を押して選んで下さい"))
+		return
+	}
+
+	ctx.Session.SearchData.setCategories(categories)
+
+	continueSearch(ctx)
+}
+
+// handlePickerPostback 店の種類の一覧の別のページを返す
+func handlePickerPostback(ctx *EventContext) {
+	ctx.reply(categoryPickerMessage(ctx.Config.Categories, ctx.Session.SearchData.Selected, ctx.Postback.Page))
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+// handleCommand テキストで送られたコマンドを実行する
+func handleCommand(ctx *EventContext, command string) {
+	switch command {
+	case commandHelp:
+		ctx.reply(linebot.NewTextMessage(helpText(ctx.Config)).WithQuickReplies(promptQuickReplies(ctx.Session.SearchData, ctx.recentPlaces())))
+
+	case commandReset:
+		ctx.Session.SearchData = initializeSearchData()
+		ctx.Session.ShopData = &ShopData{}
+		ctx.reply(linebot.NewTextMessage("検索条件をリセットしました．位置情報か場所の名称を送ると新しく検索できます").WithQuickReplies(promptQuickReplies(ctx.Session.SearchData, ctx.recentPlaces())))
+
+	case commandFavorites:
+		showFavorites(ctx)
+
+	case commandNext:
+		handleNextPostback(ctx)
+
+	case commandPreferences:
+		showPreferences(ctx)
+
+	case commandHistory:
+		showHistory(ctx)
+	}
+}
+
+// helpText 使い方の説明を返す．店の種類とコマンドの言葉は設定から作る
+func helpText(conf *Config) string {
+	var names []string
+	for _, category := range conf.Categories {
+		names = append(names, category.Name)
+	}
+
+	lines := []string{
+		"【使い方】",
+		"・位置情報か場所の名称を送ると，その周辺のお店を探します",
+		"・「渋谷 古着屋」のように場所と種類をまとめて送れます",
+		"・「検索 電源あるカフェ 新宿」のように自由な言葉でも探せます",
+		"",
+		"種類: " + strings.Join(names, "，"),
+	}
+	for _, command := range []struct{ key, description string }{
+		{commandNext, "次の結果を表示"},
+		{commandPreferences, "好みを設定"},
+		{commandFavorites, "お気に入りを表示"},
+		{commandHistory, "最近の検索を表示"},
+		{commandReset, "検索条件をリセット"},
+	} {
+		if words := conf.Commands[command.key]; len(words) > 0 {
+			lines = append(lines, "「"+words[0]+"」: "+command.description)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"log"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"googlemaps.github.io/maps"
+)
+
+func init() {
+	router.onPostback(actionTravelModeMenu, handleTravelModeMenuPostback)
+	router.onPostback(actionTravelMode, handleTravelModePostback)
+	router.onPostback(actionRoute, handleRoutePostback)
+}
+
+// handleTravelModeMenuPostback 経路の移動手段の選択肢を返す
+func handleTravelModeMenuPostback(ctx *EventContext) {
+	current := store.profile(ctx.userID()).travelMode()
+
+	ctx.reply(linebot.NewTextMessage("「ここへ行く」で使う移動手段を選んで下さい\n現在: " + modeName(current)).WithQuickReplies(travelModeQuickReplies(current)))
+}
+
+// handleTravelModePostback 選ばれた移動手段を保存する
+func handleTravelModePostback(ctx *EventContext) {
+	mode := maps.Mode(ctx.Postback.Filters["mode"])
+	if !isTravelMode(mode) {
+		ctx.reply(linebot.NewTextMessage("この移動手段は選べません．もう一度選んで下さい"))
+		return
+	}
+
+	err := store.updateProfile(ctx.userID(), func(profile *UserProfile) {
+		profile.TravelMode = string(mode)
+	})
+	if err != nil {
+		log.Print(err)
+		ctx.reply(linebot.NewTextMessage("移動手段を保存できませんでした．時間をおいてもう一度お試し下さい"))
+		return
+	}
+
+	ctx.reply(linebot.NewTextMessage("次の検索から「ここへ行く」を" + modeName(mode) + "の経路で開きます"))
+}
+
+// handleRoutePostback ボタンを押したバブルの検索地点から店までの経路の要約を返す
+func handleRoutePostback(ctx *EventContext) {
+	origin := ctx.Postback.Location
+	mode := maps.Mode(ctx.Postback.Filters["mode"])
+	if len(origin) != 2 || !isTravelMode(mode) {
+		ctx.reply(linebot.NewTextMessage("経路を調べられません．もう一度検索して下さい"))
+		return
+	}
+
+	summary, err := routeSummary(origin, ctx.Postback.PlaceID, mode)
+	if err != nil {
+		log.Printf("directions to %s failed: %v", ctx.Postback.PlaceID, err)
+		ctx.reply(linebot.NewTextMessage("経路が見つかりませんでした"))
+		return
+	}
+
+	ctx.reply(linebot.NewTextMessage(summary))
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+func init() {
+	router.onPostback(actionAddFavorite, handleAddFavoritePostback)
+	router.onPostback(actionRemoveFavorite, handleRemoveFavoritePostback)
+	router.onPostback(actionFavorites, showFavorites)
+	router.onPostback(actionFavoriteMenu, handleFavoriteMenuPostback)
+	router.onPostback(actionMoveFavorite, handleMoveFavoritePostback)
+	router.onPostback(actionNewList, handleNewListPostback)
+	router.onPostback(actionEditNote, handleEditNotePostback)
+	router.onPostback(actionClearNote, handleClearNotePostback)
+}
+
+// handleAddFavoritePostback バブルの店をお気に入りに保存する
+func handleAddFavoritePostback(ctx *EventContext) {
+	shopDetail, err := getPlaceDetails(ctx.Postback.PlaceID)
+	if err != nil {
+		log.Printf("details of %s failed: %v", ctx.Postback.PlaceID, err)
+		ctx.reply(linebot.NewTextMessage("お店の情報を取得できませんでした．時間をおいてもう一度お試し下さい"))
+		return
+	}
+
+	favorite := Favorite{
+		PlaceID:  shopDetail.PlaceID,
+		Name:     shopDetail.Name,
+		Vicinity: shopDetail.Vicinity,
+		AddedAt:  time.Now(),
+	}
+	if shopData := ctx.Session.ShopData; shopData != nil {
+		favorite.LocationName = shopData.Query.LocationName
+	}
+
+	var added, full bool
+	err = store.updateProfile(ctx.userID(), func(profile *UserProfile) {
+		full = len(profile.Favorites) >= maxFavorites
+		added = profile.addFavorite(favorite)
+	})
+	if err != nil {
+		log.Print(err)
+		ctx.reply(linebot.NewTextMessage("お気に入りを保存できませんでした．時間をおいてもう一度お試し下さい"))
+		return
+	}
+
+	var text string
+	switch {
+	case added:
+		text = "「" + favorite.Name + "」をお気に入りに追加しました"
+	case full:
+		text = "お気に入りがいっぱいです．一覧から不要なお店を外して下さい"
+	default:
+		text = "「" + favorite.Name + "」は既にお気に入りに入っています"
+	}
+	ctx.reply(linebot.NewTextMessage(text).WithQuickReplies(quickReplyItems(
+		postbackQuickReply("お気に入りを見る", PostbackData{Action: actionFavorites}),
+	)))
+}
+
+// handleRemoveFavoritePostback 店をお気に入りから外す
+func handleRemoveFavoritePostback(ctx *EventContext) {
+	var favorite Favorite
+	var removed bool
+	err := store.updateProfile(ctx.userID(), func(profile *UserProfile) {
+		favorite, _ = profile.favorite(ctx.Postback.PlaceID)
+		removed = profile.removeFavorite(ctx.Postback.PlaceID)
+	})
+	if err != nil {
+		log.Print(err)
+		ctx.reply(linebot.NewTextMessage("お気に入りを変更できませんでした．時間をおいてもう一度お試し下さい"))
+		return
+	}
+
+	text := "このお店はお気に入りに入っていません"
+	if removed {
+		text = "「" + favorite.Name + "」をお気に入りから外しました"
+	}
+	ctx.reply(linebot.NewTextMessage(text).WithQuickReplies(quickReplyItems(
+		postbackQuickReply("お気に入りを見る", PostbackData{Action: actionFavorites}),
+	)))
+}
+
+// showFavorites お気に入りの店を最新の情報でカルーセルにして返す．リストかタグで絞り込める
+func showFavorites(ctx *EventContext) {
+	page := 0
+	var filters map[string]string
+	if ctx.Postback != nil {
+		page = ctx.Postback.Page
+		filters = ctx.Postback.Filters
+	}
+
+	profile := store.profile(ctx.userID())
+	if len(profile.Favorites) == 0 {
+		ctx.reply(noFavoritesMessage(ctx.Session.SearchData, ctx.recentPlaces()))
+		return
+	}
+
+	quickReply := favoriteFilterQuickReplies(profile, filters)
+	if quickReply == nil {
+		quickReply = promptQuickReplies(ctx.Session.SearchData, ctx.recentPlaces())
+	}
+
+	filtered := filterFavorites(profile.Favorites, filters)
+	if len(filtered) == 0 {
+		ctx.reply(linebot.NewTextMessage("「" + describeFavoriteFilters(filters) + "」のお気に入りはありません").WithQuickReplies(quickReply))
+		return
+	}
+
+	favorites, hasNext := favoritesPage(filtered, page)
+	if len(favorites) == 0 {
+		page = 0
+		favorites, hasNext = favoritesPage(filtered, page)
+	}
+
+	bubbles := getFavoriteBubbles(ctx.Config, favorites, page, hasNext, filters, profile.travelMode())
+	sendFlexMessage(ctx.Config, bubbles, favoritesAltText(len(filtered), page, filters), ctx.Event.ReplyToken, quickReply)
+}
+
+// handleFavoriteMenuPostback お気に入りの店のリスト，メモ，タグと，それらを変える操作を返す
+func handleFavoriteMenuPostback(ctx *EventContext) {
+	ctx.Session.Pending = nil
+
+	profile := store.profile(ctx.userID())
+	favorite, ok := profile.favorite(ctx.Postback.PlaceID)
+	if !ok {
+		ctx.reply(linebot.NewTextMessage("このお店はお気に入りに入っていません"))
+		return
+	}
+
+	list := favorite.List
+	if len(list) == 0 {
+		list = noList
+	}
+	lines := []string{favorite.Name, "リスト: " + list}
+	if len(favorite.Note) > 0 {
+		lines = append(lines, "メモ: "+favorite.Note)
+	}
+	if len(favorite.Tags) > 0 {
+		lines = append(lines, "タグ: #"+strings.Join(favorite.Tags, " #"))
+	}
+	lines = append(lines, "入れるリストを選ぶか，メモとタグを書いて下さい")
+
+	ctx.reply(linebot.NewTextMessage(strings.Join(lines, "\n")).WithQuickReplies(favoriteMenuQuickReplies(profile, favorite)))
+}
+
+// handleMoveFavoritePostback お気に入りの店を選ばれたリストに入れる
+func handleMoveFavoritePostback(ctx *EventContext) {
+	moveFavorite(ctx, ctx.Postback.PlaceID, ctx.Postback.Name)
+}
+
+// moveFavorite お気に入りの店をリストに入れる．リスト名が空であれば未分類に戻す
+func moveFavorite(ctx *EventContext, placeID string, list string) {
+	var favorite Favorite
+	found := false
+	err := store.updateProfile(ctx.userID(), func(profile *UserProfile) {
+		found = profile.updateFavorite(placeID, func(f *Favorite) {
+			f.List = list
+			favorite = *f
+		})
+	})
+	if err != nil {
+		log.Print(err)
+		ctx.reply(linebot.NewTextMessage("お気に入りを変更できませんでした．時間をおいてもう一度お試し下さい"))
+		return
+	}
+	if !found {
+		ctx.reply(linebot.NewTextMessage("このお店はお気に入りに入っていません"))
+		return
+	}
+
+	if len(list) == 0 {
+		list = noList
+	}
+	ctx.reply(linebot.NewTextMessage("「" + favorite.Name + "」を「" + list + "」に入れました").WithQuickReplies(quickReplyItems(
+		postbackQuickReply(list+"を見る", PostbackData{Action: actionFavorites, Filters: map[string]string{"list": favorite.List}}),
+		postbackQuickReply("お気に入りを見る", PostbackData{Action: actionFavorites}),
+	)))
+}
+
+// handleNewListPostback 新しいリストの名前を送ってもらう
+func handleNewListPostback(ctx *EventContext) {
+	ctx.Session.Pending = &PendingInput{Kind: inputListName, PlaceID: ctx.Postback.PlaceID}
+	ctx.reply(linebot.NewTextMessage(fmt.Sprintf("新しいリストの名前を%d文字以内で送って下さい\n(例：原宿で行きたい)", maxListNameLength)).WithQuickReplies(quickReplyItems(
+		postbackQuickReply("やめる", PostbackData{Action: actionFavoriteMenu, PlaceID: ctx.Postback.PlaceID}),
+	)))
+}
+
+// handleEditNotePostback お気に入りの店のメモとタグを送ってもらう
+func handleEditNotePostback(ctx *EventContext) {
+	ctx.Session.Pending = &PendingInput{Kind: inputNote, PlaceID: ctx.Postback.PlaceID}
+	ctx.reply(linebot.NewTextMessage(fmt.Sprintf("メモを%d文字以内で送って下さい．「#」で始まる言葉はタグになります\n(例：店主がリーバイス詳しい #デニム)", maxNoteLength)).WithQuickReplies(quickReplyItems(
+		postbackQuickReply("やめる", PostbackData{Action: actionFavoriteMenu, PlaceID: ctx.Postback.PlaceID}),
+	)))
+}
+
+// handleClearNotePostback お気に入りの店のメモとタグを消す
+func handleClearNotePostback(ctx *EventContext) {
+	saveNote(ctx, ctx.Postback.PlaceID, "", nil)
+}
+
+// handlePendingInput 待っていたリスト名やメモを受け取る
+func handlePendingInput(ctx *EventContext, pending *PendingInput, text string) {
+	text = strings.TrimSpace(text)
+
+	switch pending.Kind {
+	case inputListName:
+		if !validListName(text) {
+			ctx.Session.Pending = pending
+			ctx.reply(linebot.NewTextMessage(fmt.Sprintf("リストの名前は%d文字以内で，「%s」以外にして下さい", maxListNameLength, noList)))
+			return
+		}
+		moveFavorite(ctx, pending.PlaceID, text)
+
+	case inputNote:
+		note, tags := parseNote(text)
+		saveNote(ctx, pending.PlaceID, note, tags)
+	}
+}
+
+// saveNote お気に入りの店のメモとタグを保存する
+func saveNote(ctx *EventContext, placeID string, note string, tags []string) {
+	var favorite Favorite
+	found := false
+	err := store.updateProfile(ctx.userID(), func(profile *UserProfile) {
+		found = profile.updateFavorite(placeID, func(f *Favorite) {
+			f.Note = note
+			f.Tags = tags
+			favorite = *f
+		})
+	})
+	if err != nil {
+		log.Print(err)
+		ctx.reply(linebot.NewTextMessage("メモを保存できませんでした．時間をおいてもう一度お試し下さい"))
+		return
+	}
+	if !found {
+		ctx.reply(linebot.NewTextMessage("このお店はお気に入りに入っていません"))
+		return
+	}
+
+	text := "「" + favorite.Name + "」のメモとタグを消しました"
+	if len(note) > 0 || len(tags) > 0 {
+		text = "「" + favorite.Name + "」のメモを保存しました"
+	}
+	ctx.reply(linebot.NewTextMessage(text).WithQuickReplies(quickReplyItems(
+		postbackQuickReply("お気に入りを見る", PostbackData{Action: actionFavorites}),
+	)))
+}
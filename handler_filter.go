@@ -0,0 +1,62 @@
+package main
+
+import (
+	"log"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+func init() {
+	router.onPostback(actionFilterMenu, handleFilterMenuPostback)
+	router.onPostback(actionFilter, handleFilterPostback)
+	router.onPostback(actionClearFilters, handleClearFiltersPostback)
+}
+
+// handleFilterMenuPostback 現在の絞り込み条件と，条件を切り替えるクイックリプライを返す
+func handleFilterMenuPostback(ctx *EventContext) {
+	filters := store.profile(ctx.userID()).Filters
+
+	current := filters.describe()
+	if len(current) == 0 {
+		current = "なし"
+	}
+
+	ctx.reply(linebot.NewTextMessage("現在の絞り込み: " + current + "\n次回の検索から適用します").WithQuickReplies(filterQuickReplies(filters)))
+}
+
+// handleFilterPostback 絞り込み条件を1つ切り替えて保存する
+func handleFilterPostback(ctx *EventContext) {
+	var toggleErr error
+	err := store.updateProfile(ctx.userID(), func(profile *UserProfile) {
+		for key, value := range ctx.Postback.Filters {
+			if toggleErr = profile.Filters.toggle(key, value); toggleErr != nil {
+				return
+			}
+		}
+	})
+	if toggleErr != nil {
+		log.Printf("invalid filter from %s: %v", ctx.userID(), toggleErr)
+		ctx.reply(linebot.NewTextMessage("この条件は選べません．もう一度選んで下さい"))
+		return
+	}
+	if err != nil {
+		log.Print(err)
+		ctx.reply(linebot.NewTextMessage("条件を保存できませんでした．時間をおいてもう一度お試し下さい"))
+		return
+	}
+
+	handleFilterMenuPostback(ctx)
+}
+
+// handleClearFiltersPostback 絞り込み条件を全て外す
+func handleClearFiltersPostback(ctx *EventContext) {
+	if err := store.updateProfile(ctx.userID(), func(profile *UserProfile) {
+		profile.Filters = ResultFilters{}
+	}); err != nil {
+		log.Print(err)
+		ctx.reply(linebot.NewTextMessage("条件を保存できませんでした．時間をおいてもう一度お試し下さい"))
+		return
+	}
+
+	handleFilterMenuPostback(ctx)
+}
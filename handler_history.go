@@ -0,0 +1,73 @@
+package main
+
+import (
+	"log"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+func init() {
+	router.onPostback(actionHistory, showHistory)
+	router.onPostback(actionRerun, handleRerunPostback)
+	router.onPostback(actionClearHistory, handleClearHistoryPostback)
+}
+
+// showHistory 最近の検索条件の一覧を返す
+func showHistory(ctx *EventContext) {
+	history := store.profile(ctx.userID()).History
+	if len(history) == 0 {
+		ctx.reply(linebot.NewTextMessage("検索履歴はまだありません．場所と種類を選んで検索すると記録されます").WithQuickReplies(promptQuickReplies(ctx.Session.SearchData, ctx.recentPlaces())))
+		return
+	}
+
+	ctx.reply(historyMessage(ctx.Config, history))
+}
+
+// handleRerunPostback 履歴に保存した種類か検索語，場所，範囲，絞り込みで検索し直す
+func handleRerunPostback(ctx *EventContext) {
+	profile := store.profile(ctx.userID())
+	entry, ok := profile.historyEntry(ctx.Postback.Entry)
+	if !ok {
+		ctx.reply(linebot.NewTextMessage("この履歴は見つかりません．もう一度「履歴」から選んで下さい"))
+		return
+	}
+
+	if len(entry.Text) > 0 {
+		searchData := ctx.Session.SearchData
+		searchData.Location = entry.Location
+		searchData.LocationName = entry.LocationName
+		searchData.Rerun = &entry
+
+		startTextSearch(ctx, entry.Text)
+		return
+	}
+
+	categories := ctx.Config.categories(entry.Categories)
+	if len(categories) == 0 || len(entry.Location) != 2 {
+		log.Printf("history entry %d of %s cannot be rerun: %q", entry.id(), ctx.userID(), entry.Categories)
+		ctx.reply(linebot.NewTextMessage("この履歴の種類は現在使えません．種類を選び直して下さい").WithQuickReplies(promptQuickReplies(ctx.Session.SearchData, ctx.recentPlaces())))
+		return
+	}
+
+	searchData := ctx.Session.SearchData
+	searchData.setCategories(categories)
+	searchData.Location = entry.Location
+	searchData.LocationName = entry.LocationName
+	searchData.Bounds = entry.Bounds
+	searchData.Rerun = &entry
+
+	continueSearch(ctx)
+}
+
+// handleClearHistoryPostback 検索履歴を全て消す
+func handleClearHistoryPostback(ctx *EventContext) {
+	if err := store.updateProfile(ctx.userID(), func(profile *UserProfile) {
+		profile.History = nil
+	}); err != nil {
+		log.Print(err)
+		ctx.reply(linebot.NewTextMessage("履歴を消せませんでした．時間をおいてもう一度お試し下さい"))
+		return
+	}
+
+	ctx.reply(linebot.NewTextMessage("検索履歴を消しました").WithQuickReplies(promptQuickReplies(ctx.Session.SearchData, ctx.recentPlaces())))
+}
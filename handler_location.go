@@ -0,0 +1,21 @@
+package main
+
+import (
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+func init() {
+	router.onMessage(linebot.MessageTypeLocation, handleLocationMessage)
+}
+
+// handleLocationMessage 送られた位置情報を検索場所に設定する．場所の名前は住所と最寄り駅から作る
+func handleLocationMessage(ctx *EventContext) {
+	message := ctx.Event.Message.(*linebot.LocationMessage)
+	searchData := ctx.Session.SearchData
+
+	searchData.Location = []float64{message.Latitude, message.Longitude}
+	searchData.LocationName = describeLocation(searchData.Location, message.Address)
+	searchData.Bounds = nil
+
+	continueSearch(ctx)
+}
@@ -0,0 +1,12 @@
+package main
+
+func init() {
+	router.onPostback(actionNext, handleNextPostback)
+}
+
+// handleNextPostback 次の10件の検索を指示する
+func handleNextPostback(ctx *EventContext) {
+	ctx.Session.SearchData.Type = actionNext
+
+	continueSearch(ctx)
+}
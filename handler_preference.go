@@ -0,0 +1,117 @@
+package main
+
+import (
+	"log"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+// maxQuickReplyItems クイックリプライに並べられるボタンの最大数
+const maxQuickReplyItems = 13
+
+func init() {
+	router.onPostback(actionPreference, showPreferences)
+	router.onPostback(actionGender, handleGenderPostback)
+	router.onPostback(actionStyle, handleStylePostback)
+	router.onPostback(actionClearStyles, handleClearStylesPostback)
+	router.onPostback(actionToggleConfirm, handleToggleConfirmPostback)
+}
+
+// showPreferences 現在の好みと，対象・スタイル・場所の確認を切り替えるクイックリプライを返す
+func showPreferences(ctx *EventContext) {
+	profile := store.profile(ctx.userID())
+
+	current := ctx.Config.describeProfile(profile)
+	if len(current) == 0 {
+		current = "指定なし"
+	}
+
+	// 対象とスタイルは，末尾に必ず付けるボタンの分を残して上限まで並べる
+	extras := []*linebot.QuickReplyButton{
+		postbackQuickReply("スタイルをクリア", PostbackData{Action: actionClearStyles}),
+		postbackQuickReply(checkLabel("場所を確認", !profile.SkipConfirm), PostbackData{Action: actionToggleConfirm}),
+	}
+	room := maxQuickReplyItems - len(extras)
+
+	var buttons []*linebot.QuickReplyButton
+	for _, gender := range ctx.Config.Genders {
+		if len(buttons) >= room {
+			break
+		}
+		buttons = append(buttons, postbackQuickReply(checkLabel(gender.Name, profile.Gender == gender.Key), PostbackData{
+			Action:  actionGender,
+			Filters: map[string]string{"gender": gender.Key},
+		}))
+	}
+	for _, style := range ctx.Config.Styles {
+		if len(buttons) >= room {
+			break
+		}
+		buttons = append(buttons, postbackQuickReply(checkLabel(style, contains(profile.Styles, style)), PostbackData{
+			Action:  actionStyle,
+			Filters: map[string]string{"style": style},
+		}))
+	}
+	buttons = append(buttons, extras...)
+
+	ctx.reply(linebot.NewTextMessage("現在の好み: " + current + "\n衣料品を検索するときの対象とスタイルを選んで下さい\n「場所を確認」を選ぶと，地名で検索する前に地図で場所を確認します").WithQuickReplies(quickReplyItems(buttons...)))
+}
+
+// handleGenderPostback 衣料品の検索対象を保存する
+func handleGenderPostback(ctx *EventContext) {
+	gender, ok := ctx.Config.gender(ctx.Postback.Filters["gender"])
+	if !ok {
+		ctx.reply(linebot.NewTextMessage("この対象は選べません．もう一度選んで下さい"))
+		return
+	}
+
+	updatePreferences(ctx, func(profile *UserProfile) {
+		profile.Gender = gender.Key
+	})
+}
+
+// handleStylePostback スタイルを好みに加える，または外す
+func handleStylePostback(ctx *EventContext) {
+	style := ctx.Postback.Filters["style"]
+	if !contains(ctx.Config.Styles, style) {
+		ctx.reply(linebot.NewTextMessage("このスタイルは選べません．もう一度選んで下さい"))
+		return
+	}
+
+	updatePreferences(ctx, func(profile *UserProfile) {
+		profile.toggleStyle(style)
+	})
+}
+
+// handleClearStylesPostback スタイルの好みを全て外す
+func handleClearStylesPostback(ctx *EventContext) {
+	updatePreferences(ctx, func(profile *UserProfile) {
+		profile.Styles = nil
+	})
+}
+
+// handleToggleConfirmPostback 地名で検索する前に場所を確認するかを切り替える
+func handleToggleConfirmPostback(ctx *EventContext) {
+	updatePreferences(ctx, func(profile *UserProfile) {
+		profile.SkipConfirm = !profile.SkipConfirm
+	})
+}
+
+// updatePreferences 好みを変更して保存し，変更後の好みを返す
+func updatePreferences(ctx *EventContext, update func(profile *UserProfile)) {
+	if err := store.updateProfile(ctx.userID(), update); err != nil {
+		log.Print(err)
+		ctx.reply(linebot.NewTextMessage("好みを保存できませんでした．時間をおいてもう一度お試し下さい"))
+		return
+	}
+
+	showPreferences(ctx)
+}
+
+// checkLabel 選択中の項目のラベルに印を付ける
+func checkLabel(label string, checked bool) string {
+	if checked {
+		return "✓" + label
+	}
+	return label
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"log"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+func init() {
+	router.onPostback(actionRecentPlace, handlePlacePostback)
+	router.onPostback(actionPlaceCandidate, handlePlacePostback)
+	router.onPostback(actionConfirmPlace, handlePlacePostback)
+	router.onPostback(actionSkipConfirm, handleSkipConfirmPostback)
+	router.onPostback(actionChangeLocation, handleChangeLocationPostback)
+	router.onPostback(actionChangeCategory, handleChangeCategoryPostback)
+	router.onPostback(actionCancel, handleCancelPostback)
+}
+
+// handlePlacePostback 最近検索した場所や場所の候補から選ばれた場所を検索場所に設定する
+func handlePlacePostback(ctx *EventContext) {
+	if len(ctx.Postback.Location) != 2 {
+		ctx.reply(linebot.NewTextMessage("この場所は選べません．位置情報を送るか場所の名称を送って下さい"))
+		return
+	}
+
+	searchData := ctx.Session.SearchData
+	searchData.Location = ctx.Postback.Location
+	searchData.LocationName = ctx.Postback.Name
+	searchData.Bounds = ctx.Postback.Bounds
+
+	continueSearch(ctx)
+}
+
+// handleSkipConfirmPostback 次回から場所の確認を省くよう保存し，確認していた場所で検索する
+func handleSkipConfirmPostback(ctx *EventContext) {
+	err := store.updateProfile(ctx.userID(), func(profile *UserProfile) {
+		profile.SkipConfirm = true
+	})
+	if err != nil {
+		log.Print(err)
+	}
+
+	handlePlacePostback(ctx)
+}
+
+// handleChangeLocationPostback 検索場所を消して入力し直してもらう
+func handleChangeLocationPostback(ctx *EventContext) {
+	searchData := ctx.Session.SearchData
+	searchData.Location = nil
+	searchData.LocationName = ""
+	searchData.Bounds = nil
+
+	ctx.reply(linebot.NewTextMessage("位置情報を送るか検索したい場所の名称を送ってください\n(例：東京駅)").WithQuickReplies(promptQuickReplies(searchData, ctx.recentPlaces())))
+}
+
+// handleChangeCategoryPostback 店の種類を消して選び直してもらう
+func handleChangeCategoryPostback(ctx *EventContext) {
+	searchData := ctx.Session.SearchData
+	searchData.Type = ""
+	searchData.TypeName = ""
+	searchData.Types = nil
+
+	ctx.reply(categoryPickerMessage(ctx.Config.Categories, searchData.Selected, 0).WithQuickReplies(promptQuickReplies(searchData, ctx.recentPlaces())))
+}
+
+// handleCancelPostback 入力中の検索条件を破棄する
+func handleCancelPostback(ctx *EventContext) {
+	ctx.Session.SearchData = initializeSearchData()
+
+	ctx.reply(linebot.NewTextMessage("検索をキャンセルしました．位置情報か場所の名称を送ると新しく検索できます").WithQuickReplies(promptQuickReplies(ctx.Session.SearchData, ctx.recentPlaces())))
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+func init() {
+	router.onPostback(actionRangeMenu, handleRangeMenuPostback)
+	router.onPostback(actionRange, handleRangePostback)
+}
+
+// handleRangeMenuPostback 検索範囲と並び順の選択肢を返す
+func handleRangeMenuPostback(ctx *EventContext) {
+	current := store.profile(ctx.userID()).searchRange()
+
+	ctx.reply(linebot.NewTextMessage("検索する範囲と並び順を選んで下さい\n現在: " + current.describe()).WithQuickReplies(searchRangeQuickReplies(ctx.Config.RadiusOptions, current)))
+}
+
+// handleRangePostback 選ばれた検索範囲と並び順を保存し，検索条件が揃っていれば検索する
+func handleRangePostback(ctx *EventContext) {
+	radius, err := strconv.ParseUint(ctx.Postback.Filters["radius"], 10, 32)
+	rankBy := ctx.Postback.Filters["rank"]
+	if err != nil || (rankBy != rankByDistance && rankBy != rankByProminence && rankBy != rankByScore) {
+		ctx.reply(linebot.NewTextMessage("この条件は選べません．もう一度選んで下さい"))
+		return
+	}
+
+	err = store.updateProfile(ctx.userID(), func(profile *UserProfile) {
+		profile.Radius = uint(radius)
+		profile.RankBy = rankBy
+	})
+	if err != nil {
+		log.Print(err)
+		ctx.reply(linebot.NewTextMessage("条件を保存できませんでした．時間をおいてもう一度お試し下さい"))
+		return
+	}
+
+	searchData := ctx.Session.SearchData
+	if len(searchData.Location) == 0 || len(searchData.Type) == 0 {
+		selected := SearchRange{Radius: uint(radius), RankBy: rankBy}
+		ctx.reply(linebot.NewTextMessage("次回から " + selected.describe() + " で検索します"))
+		return
+	}
+
+	continueSearch(ctx)
+}
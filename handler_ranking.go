@@ -0,0 +1,22 @@
+package main
+
+import "github.com/line/line-bot-sdk-go/linebot"
+
+func init() {
+	router.onPostback(actionExplainRank, handleExplainRankPostback, adminOnly)
+}
+
+// handleExplainRankPostback 店がおすすめ順でその順位になった理由を返す
+func handleExplainRankPostback(ctx *EventContext) {
+	var score ScoreBreakdown
+	ok := false
+	if shopData := ctx.Session.ShopData; shopData != nil {
+		score, ok = shopData.Scores[ctx.Postback.PlaceID]
+	}
+	if !ok {
+		ctx.reply(linebot.NewTextMessage("順位の情報がありません．もう一度検索して下さい"))
+		return
+	}
+
+	ctx.reply(linebot.NewTextMessage(score.explain()))
+}
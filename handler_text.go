@@ -0,0 +1,94 @@
+package main
+
+import (
+	"log"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+func init() {
+	router.onMessage(linebot.MessageTypeText, handleTextMessage)
+}
+
+// handleTextMessage 送られたメッセージを分類し，コマンドの実行，自由な言葉での検索，店の種類と検索場所の設定を行う
+func handleTextMessage(ctx *EventContext) {
+	message := ctx.Event.Message.(*linebot.TextMessage)
+	intent := ctx.Config.classify(message.Text)
+
+	// リスト名やメモを待っているときはコマンド以外をその入力として受け取る
+	if pending := ctx.Session.Pending; pending != nil {
+		ctx.Session.Pending = nil
+		if intent.Kind != intentCommand {
+			handlePendingInput(ctx, pending, message.Text)
+			return
+		}
+	}
+
+	switch intent.Kind {
+	case intentCommand:
+		handleCommand(ctx, intent.Command)
+		return
+	case intentTextSearch:
+		startTextSearch(ctx, intent.Text)
+		return
+	}
+
+	searchData := ctx.Session.SearchData
+	if len(intent.Categories) > 0 {
+		searchData.setCategories(intent.Categories)
+	}
+	if intent.Kind == intentCategory {
+		continueSearch(ctx)
+		return
+	}
+
+	candidates, ambiguous, err := geocode(ctx.Config.Geocode, intent.Place)
+	if err != nil {
+		log.Printf("geocoding %q failed: %v", intent.Place, err)
+	}
+	if len(candidates) == 0 {
+		ctx.reply(linebot.NewTextMessage("入力された地名が見つかりません").WithQuickReplies(promptQuickReplies(searchData, ctx.recentPlaces())))
+		return
+	}
+	if ambiguous {
+		ctx.reply(placeCandidatesMessage(intent.Place, candidates))
+		return
+	}
+
+	if !store.profile(ctx.userID()).SkipConfirm {
+		ctx.reply(confirmPlaceMessage(ctx.Config, intent.Place, candidates[0]))
+		return
+	}
+
+	searchData.Location = candidates[0].Location
+	searchData.LocationName = intent.Place
+	searchData.Bounds = candidates[0].Bounds
+
+	continueSearch(ctx)
+}
+
+// startTextSearch 自由な言葉で検索する．位置情報が送られていればその周辺を優先する
+func startTextSearch(ctx *EventContext, text string) {
+	if len(text) == 0 {
+		ctx.reply(linebot.NewTextMessage("検索したい言葉を続けて送って下さい\n(例：検索 電源あるカフェ 新宿)"))
+		return
+	}
+
+	session := ctx.Session
+	searchData := session.SearchData
+	profile := searchData.searchProfile()
+
+	summary := "検索語: " + text
+	if len(searchData.Location) > 0 {
+		summary += "\n周辺: " + searchData.LocationName
+	}
+	if filters := profile.Filters.describe(); len(filters) > 0 {
+		summary += "\n絞り込み: " + filters
+	}
+	if _, err := ctx.Bot.PushMessage(ctx.userID(), linebot.NewTextMessage(summary), linebot.NewTextMessage("上記内容で検索します")).Do(); err != nil {
+		log.Print(err)
+	}
+
+	session.ShopData = buildAndSendTextSearchMessage(ctx.Bot, ctx.Config, text, searchData, profile)
+	session.SearchData = initializeSearchData()
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"log"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+const (
+	// maxHistory ユーザごとに残す検索履歴の最大数
+	maxHistory = 20
+	// historyPerMessage 履歴の一覧に表示する件数
+	historyPerMessage = 10
+)
+
+// jst 履歴やお気に入りの日時を表示するタイムゾーン
+var jst = time.FixedZone("JST", 9*60*60)
+
+// SearchHistory 検索した条件の履歴
+type SearchHistory struct {
+	Categories   []string `json:"categories,omitempty"`
+	CategoryName string   `json:"categoryName,omitempty"`
+	// Text 自由な言葉で検索したときの検索語
+	Text         string        `json:"text,omitempty"`
+	LocationName string        `json:"locationName"`
+	Location     []float64     `json:"location"`
+	Bounds       []float64     `json:"bounds,omitempty"`
+	Filters      ResultFilters `json:"filters"`
+	Range        SearchRange   `json:"range"`
+	SearchedAt   time.Time     `json:"searchedAt"`
+}
+
+// newSearchHistory 検索条件から履歴を作る．範囲を広げる前の条件を渡す
+func newSearchHistory(query SearchQuery, categories []CategoryConfig) SearchHistory {
+	var keys, names []string
+	for _, category := range categories {
+		keys = append(keys, category.Key)
+		names = append(names, category.Name)
+	}
+
+	return SearchHistory{
+		Categories:   keys,
+		CategoryName: strings.Join(names, "・"),
+		Text:         query.Text,
+		LocationName: query.LocationName,
+		Location:     query.Origin,
+		Bounds:       query.Bounds,
+		Filters:      query.Filters,
+		Range:        query.Range,
+		SearchedAt:   time.Now(),
+	}
+}
+
+// sameConditions 種類，場所，範囲，絞り込みが同じ検索か判定する
+func (h SearchHistory) sameConditions(other SearchHistory) bool {
+	return reflect.DeepEqual(h.Categories, other.Categories) &&
+		h.Text == other.Text &&
+		h.LocationName == other.LocationName &&
+		reflect.DeepEqual(h.Location, other.Location) &&
+		h.Filters == other.Filters &&
+		h.Range == other.Range
+}
+
+// id 履歴を選ぶポストバックで使う識別子を返す
+func (h SearchHistory) id() int64 {
+	return h.SearchedAt.UnixNano()
+}
+
+// title 履歴の一覧に表示する種類か検索語と，場所を返す
+func (h SearchHistory) title() string {
+	title := h.CategoryName
+	if len(h.Text) > 0 {
+		title = "「" + h.Text + "」"
+	}
+	if len(h.LocationName) == 0 {
+		return title
+	}
+	return title + "・" + h.LocationName
+}
+
+// describe 履歴の一覧に表示する条件の説明を返す
+func (h SearchHistory) describe() string {
+	searchRange := h.Range.describe()
+	if len(h.Bounds) > 0 {
+		searchRange = h.Range.describeArea()
+	}
+	text := h.SearchedAt.In(jst).Format("01/02 15:04") + " " + searchRange
+	if filters := h.Filters.describe(); len(filters) > 0 {
+		text += "\n絞り込み: " + filters
+	}
+	return text
+}
+
+// addHistory 履歴の先頭に検索を加える．同じ条件の古い履歴は除き，上限を超えた分は古いものから消す
+func (p *UserProfile) addHistory(entry SearchHistory) {
+	history := []SearchHistory{entry}
+	for _, h := range p.History {
+		if len(history) == maxHistory {
+			break
+		}
+		if !h.sameConditions(entry) {
+			history = append(history, h)
+		}
+	}
+	p.History = history
+}
+
+// recordHistory 検索条件をユーザの履歴に残す
+func recordHistory(userID string, entry SearchHistory) {
+	if err := store.updateProfile(userID, func(p *UserProfile) {
+		p.addHistory(entry)
+	}); err != nil {
+		log.Print(err)
+	}
+}
+
+// historyEntry 識別子に当たる履歴を返す
+func (p *UserProfile) historyEntry(id int64) (SearchHistory, bool) {
+	for _, h := range p.History {
+		if h.id() == id {
+			return h, true
+		}
+	}
+	return SearchHistory{}, false
+}
+
+// historyMessage 最近の検索条件を並べ，同じ条件で検索し直すボタンを付けたメッセージを構築する
+func historyMessage(conf *Config, history []SearchHistory) linebot.SendingMessage {
+	if len(history) > historyPerMessage {
+		history = history[:historyPerMessage]
+	}
+
+	contents := []ContentsContainer{
+		&Text{
+			Type:   typeText,
+			Text:   "最近の検索",
+			Size:   sizeLg,
+			Weight: "bold",
+		},
+	}
+	for _, h := range history {
+		contents = append(contents, buildHistoryRow(conf, h))
+	}
+
+	bubble := &Bubble{
+		Type: typeBubble,
+		Body: &Box{
+			Type:     typeBox,
+			Layout:   layoutVertical,
+			Spacing:  sizeMd,
+			Contents: contents,
+		},
+		Footer: &Box{
+			Type:   typeBox,
+			Layout: layoutVertical,
+			Contents: []ContentsContainer{
+				buildPostbackActionButtonComponent("履歴を消す", PostbackData{Action: actionClearHistory}),
+			},
+		},
+	}
+
+	var names []string
+	for _, h := range history {
+		names = append(names, h.title())
+	}
+	return toFlexMessage("最近の検索: "+strings.Join(names, "，"), &Carousel{
+		Type:     typeCarousel,
+		Contents: []*Bubble{bubble},
+	})
+}
+
+// buildHistoryRow 履歴1件分の条件と，同じ条件で検索するボタンを構築
+func buildHistoryRow(conf *Config, h SearchHistory) *Box {
+	return &Box{
+		Type:   typeBox,
+		Layout: layoutVertical,
+		Margin: sizeLg,
+		Contents: []ContentsContainer{
+			&Text{
+				Type:   typeText,
+				Text:   h.title(),
+				Size:   sizeMd,
+				Wrap:   true,
+				Weight: "bold",
+				Color:  conf.Theme.Text,
+			},
+			&Text{
+				Type:  typeText,
+				Text:  h.describe(),
+				Size:  sizeXs,
+				Wrap:  true,
+				Color: conf.Theme.Label,
+			},
+			buildPostbackActionButtonComponent("同じ条件で検索", PostbackData{Action: actionRerun, Entry: h.id()}),
+		},
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// テキストメッセージの意図の種類
+const (
+	intentPlace            = "place"
+	intentCategory         = "category"
+	intentPlaceAndCategory = "place+category"
+	intentCommand          = "command"
+	intentTextSearch       = "text"
+)
+
+// コマンドのキー
+const (
+	commandHelp        = "help"
+	commandReset       = "reset"
+	commandFavorites   = "favorites"
+	commandNext        = "next"
+	commandPreferences = "preferences"
+	commandHistory     = "history"
+)
+
+// commandKeys 辞書に登録できるコマンドのキー
+var commandKeys = []string{commandHelp, commandReset, commandFavorites, commandNext, commandPreferences, commandHistory}
+
+// Intent テキストメッセージを分類した結果
+type Intent struct {
+	Kind       string
+	Command    string
+	Categories []CategoryConfig
+	Place      string
+	Text       string
+}
+
+// defaultCommands コマンドとして扱う言葉の既定値
+func defaultCommands() map[string][]string {
+	return map[string][]string{
+		commandHelp:        {"ヘルプ", "使い方", "help"},
+		commandReset:       {"リセット", "最初から", "reset"},
+		commandFavorites:   {"お気に入り"},
+		commandNext:        {"次", "次へ", "つぎ", "次の10件"},
+		commandPreferences: {"好み", "設定", "好みを設定"},
+		commandHistory:     {"履歴", "検索履歴"},
+	}
+}
+
+// classify テキストメッセージをコマンド，自由な言葉での検索，店の種類，場所の名称に分類する．
+// 空白で区切った言葉のうち店の種類の名前や別名に当たるものを店の種類とし，残りを場所の名称とする．
+// 「渋谷の古着屋」のように場所の名称の後ろに続けて書かれた店の種類も分ける
+func (c *Config) classify(text string) Intent {
+	text = strings.TrimSpace(text)
+
+	if query, ok := textSearchQuery(text); ok {
+		return Intent{Kind: intentTextSearch, Text: query}
+	}
+	if command, ok := c.command(text); ok {
+		return Intent{Kind: intentCommand, Command: command}
+	}
+
+	var categories []CategoryConfig
+	var place []string
+	for _, word := range strings.Fields(text) {
+		category, ok := c.categoryByWord(word)
+		if !ok {
+			var rest string
+			if rest, category, ok = c.splitCategorySuffix(word); !ok {
+				place = append(place, word)
+				continue
+			}
+			place = append(place, rest)
+		}
+		if !containsCategory(categories, category.Key) {
+			categories = append(categories, category)
+		}
+	}
+
+	intent := Intent{
+		Categories: categories,
+		Place:      strings.Join(place, " "),
+	}
+	switch {
+	case len(categories) > 0 && len(place) > 0:
+		intent.Kind = intentPlaceAndCategory
+	case len(categories) > 0:
+		intent.Kind = intentCategory
+	default:
+		intent.Kind = intentPlace
+		intent.Place = text
+	}
+
+	return intent
+}
+
+// command メッセージ全体がコマンドの言葉に当たれば，そのコマンドのキーを返す
+func (c *Config) command(text string) (string, bool) {
+	text = normalizeWord(text)
+	for _, key := range commandKeys {
+		for _, word := range c.Commands[key] {
+			if normalizeWord(word) == text {
+				return key, true
+			}
+		}
+	}
+	return "", false
+}
+
+// categoryByWord 店の種類の名前か別名に当たる店の種類を返す
+func (c *Config) categoryByWord(word string) (CategoryConfig, bool) {
+	word = normalizeWord(word)
+	for _, category := range c.Categories {
+		for _, w := range category.words() {
+			if normalizeWord(w) == word {
+				return category, true
+			}
+		}
+	}
+	return CategoryConfig{}, false
+}
+
+// splitCategorySuffix 言葉が店の種類の名前か別名で終わっていれば，前の部分と店の種類に分ける
+func (c *Config) splitCategorySuffix(word string) (string, CategoryConfig, bool) {
+	word = normalizeWord(word)
+	for _, category := range c.Categories {
+		for _, w := range category.words() {
+			w = normalizeWord(w)
+			if len(w) == 0 || !strings.HasSuffix(word, w) {
+				continue
+			}
+			rest := strings.TrimSuffix(strings.TrimSuffix(word, w), "の")
+			if len(rest) > 0 {
+				return rest, category, true
+			}
+		}
+	}
+	return "", CategoryConfig{}, false
+}
+
+// words 店の種類として認識する言葉を返す
+func (c CategoryConfig) words() []string {
+	return append([]string{c.Name}, c.Synonyms...)
+}
+
+// containsCategory 店の種類の一覧にキーが含まれるか判定する
+func containsCategory(categories []CategoryConfig, key string) bool {
+	for _, category := range categories {
+		if category.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeWord 比較のために全角英数字を半角にし，小文字にそろえる
+func normalizeWord(word string) string {
+	folded := []rune(strings.TrimSpace(word))
+	for i, r := range folded {
+		if r >= '！' && r <= '～' {
+			folded[i] = r - '！' + '!'
+		}
+	}
+	return strings.ToLower(string(folded))
+}
+
+// validateCommands コマンドの辞書の問題点を返す．店の種類の言葉と重なる言葉も問題とする
+func validateCommands(commands map[string][]string, categories []CategoryConfig) []string {
+	var problems []string
+
+	owners := map[string]string{}
+	for _, category := range categories {
+		for _, word := range category.words() {
+			normalized := normalizeWord(word)
+			if owner, ok := owners[normalized]; ok && owner != "category "+category.Key {
+				problems = append(problems, fmt.Sprintf("categories: %q is used by both %s and category %s", word, owner, category.Key))
+			}
+			owners[normalized] = "category " + category.Key
+		}
+	}
+
+	for _, key := range commandKeys {
+		for i, word := range commands[key] {
+			normalized := normalizeWord(word)
+			if len(normalized) == 0 {
+				problems = append(problems, fmt.Sprintf("commands.%s[%d]: word is empty", key, i))
+				continue
+			}
+			if owner, ok := owners[normalized]; ok {
+				problems = append(problems, fmt.Sprintf("commands.%s[%d]: %q is already used by %s", key, i, word, owner))
+			}
+			owners[normalized] = "command " + key
+		}
+	}
+	var keys []string
+	for key := range commands {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !contains(commandKeys, key) {
+			problems = append(problems, fmt.Sprintf("commands: unknown command %q", key))
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	conf := defaultConfig()
+
+	tests := []struct {
+		name       string
+		text       string
+		kind       string
+		command    string
+		categories []string
+		place      string
+		query      string
+	}{
+		{name: "command", text: "ヘルプ", kind: intentCommand, command: commandHelp},
+		{name: "command with spaces", text: "  リセット ", kind: intentCommand, command: commandReset},
+		{name: "full-width command", text: "ＨＥＬＰ", kind: intentCommand, command: commandHelp},
+		{name: "upper-case command", text: "Help", kind: intentCommand, command: commandHelp},
+		{name: "category name", text: "古着屋", kind: intentCategory, categories: []string{"used"}},
+		{name: "category synonym", text: "喫茶店", kind: intentCategory, categories: []string{"cafe"}},
+		{name: "full-width synonym", text: "ＣＡＦＥ", kind: intentCategory, categories: []string{"cafe"}},
+		{name: "two categories", text: "古着 カフェ", kind: intentCategory, categories: []string{"used", "cafe"}},
+		{name: "duplicate category", text: "カフェ 喫茶", kind: intentCategory, categories: []string{"cafe"}},
+		{name: "place", text: "東京駅", kind: intentPlace, place: "東京駅"},
+		{name: "place and category", text: "渋谷 古着屋", kind: intentPlaceAndCategory, categories: []string{"used"}, place: "渋谷"},
+		{name: "category before place", text: "カフェ 下北沢", kind: intentPlaceAndCategory, categories: []string{"cafe"}, place: "下北沢"},
+		{name: "category suffix", text: "渋谷古着屋", kind: intentPlaceAndCategory, categories: []string{"used"}, place: "渋谷"},
+		{name: "category suffix with の", text: "渋谷の古着屋", kind: intentPlaceAndCategory, categories: []string{"used"}, place: "渋谷"},
+		{name: "text search", text: "検索 電源あるカフェ 新宿", kind: intentTextSearch, query: "電源あるカフェ 新宿"},
+		{name: "text search with full-width space", text: "探す　古着", kind: intentTextSearch, query: "古着"},
+		{name: "text search without words", text: "検索", kind: intentTextSearch, query: ""},
+		{name: "prefix inside a word", text: "検索結果", kind: intentPlace, place: "検索結果"},
+		{name: "empty", text: "", kind: intentPlace, place: ""},
+		{name: "spaces only", text: "   ", kind: intentPlace, place: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			intent := conf.classify(tt.text)
+
+			if intent.Kind != tt.kind {
+				t.Fatalf("classify(%q).Kind = %q, want %q", tt.text, intent.Kind, tt.kind)
+			}
+			if intent.Command != tt.command {
+				t.Errorf("classify(%q).Command = %q, want %q", tt.text, intent.Command, tt.command)
+			}
+			var keys []string
+			for _, category := range intent.Categories {
+				keys = append(keys, category.Key)
+			}
+			if !reflect.DeepEqual(keys, tt.categories) {
+				t.Errorf("classify(%q).Categories = %q, want %q", tt.text, keys, tt.categories)
+			}
+			if intent.Place != tt.place {
+				t.Errorf("classify(%q).Place = %q, want %q", tt.text, intent.Place, tt.place)
+			}
+			if intent.Text != tt.query {
+				t.Errorf("classify(%q).Text = %q, want %q", tt.text, intent.Text, tt.query)
+			}
+		})
+	}
+}
+
+func TestSplitCategorySuffix(t *testing.T) {
+	conf := defaultConfig()
+
+	tests := []struct {
+		word     string
+		rest     string
+		category string
+		ok       bool
+	}{
+		{word: "渋谷古着屋", rest: "渋谷", category: "used", ok: true},
+		{word: "原宿のセレクトショップ", rest: "原宿", category: "select", ok: true},
+		{word: "吉祥寺カフェ", rest: "吉祥寺", category: "cafe", ok: true},
+		{word: "古着屋", ok: false},
+		{word: "の古着屋", ok: false},
+		{word: "渋谷", ok: false},
+	}
+
+	for _, tt := range tests {
+		rest, category, ok := conf.splitCategorySuffix(tt.word)
+		if ok != tt.ok || rest != tt.rest || category.Key != tt.category {
+			t.Errorf("splitCategorySuffix(%q) = (%q, %q, %v), want (%q, %q, %v)", tt.word, rest, category.Key, ok, tt.rest, tt.category, tt.ok)
+		}
+	}
+}
+
+func TestCategoryByWord(t *testing.T) {
+	conf := defaultConfig()
+
+	tests := []struct {
+		word     string
+		category string
+		ok       bool
+	}{
+		{word: "古着屋", category: "used", ok: true},
+		{word: "古着", category: "used", ok: true},
+		{word: "Cafe", category: "cafe", ok: true},
+		{word: " コーヒー ", category: "cafe", ok: true},
+		{word: "本屋", ok: false},
+		{word: "", ok: false},
+	}
+
+	for _, tt := range tests {
+		category, ok := conf.categoryByWord(tt.word)
+		if ok != tt.ok || category.Key != tt.category {
+			t.Errorf("categoryByWord(%q) = (%q, %v), want (%q, %v)", tt.word, category.Key, ok, tt.category, tt.ok)
+		}
+	}
+}
+
+func TestNormalizeWord(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{word: "ＡＢＣ", want: "abc"},
+		{word: "ｃａｆｅ１２３", want: "cafe123"},
+		{word: "Cafe", want: "cafe"},
+		{word: "！？", want: "!?"},
+		{word: "  古着屋 ", want: "古着屋"},
+		{word: "カフェ", want: "カフェ"},
+		{word: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeWord(tt.word); got != tt.want {
+			t.Errorf("normalizeWord(%q) = %q, want %q", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestValidateCommands(t *testing.T) {
+	categories := defaultCategories()
+
+	tests := []struct {
+		name     string
+		commands map[string][]string
+		problems []string
+	}{
+		{
+			name:     "defaults",
+			commands: defaultCommands(),
+		},
+		{
+			name:     "empty word",
+			commands: map[string][]string{commandHelp: {"ヘルプ", " "}},
+			problems: []string{"commands.help[1]: word is empty"},
+		},
+		{
+			name:     "duplicate word in two commands",
+			commands: map[string][]string{commandHelp: {"ヘルプ"}, commandReset: {"へるぷ", "ヘルプ"}},
+			problems: []string{"commands.reset[1]: \"ヘルプ\" is already used by command help"},
+		},
+		{
+			name:     "duplicate word after normalization",
+			commands: map[string][]string{commandHelp: {"help"}, commandReset: {"ＨＥＬＰ"}},
+			problems: []string{"commands.reset[0]: \"ＨＥＬＰ\" is already used by command help"},
+		},
+		{
+			name:     "word used by a category",
+			commands: map[string][]string{commandFavorites: {"カフェ"}},
+			problems: []string{"commands.favorites[0]: \"カフェ\" is already used by category cafe"},
+		},
+		{
+			name:     "unknown command",
+			commands: map[string][]string{"search": {"さがして"}},
+			problems: []string{"commands: unknown command \"search\""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := validateCommands(tt.commands, categories)
+			if !reflect.DeepEqual(problems, tt.problems) {
+				t.Errorf("validateCommands() = %s, want %s", strings.Join(problems, "; "), strings.Join(tt.problems, "; "))
+			}
+		})
+	}
+}
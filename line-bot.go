@@ -17,12 +17,15 @@ package main
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
-	"net/http/httputil"
 	"os"
 	"reflect"
+	"strings"
+	"time"
 
 	"github.com/line/line-bot-sdk-go/linebot"
 	"googlemaps.github.io/maps"
@@ -32,82 +35,99 @@ import (
 type ShopData struct {
 	NextShops     []maps.PlacesSearchResult
 	NextPageToken string
+	Query         SearchQuery
+	Scores        map[string]ScoreBreakdown
 }
 
 // SearchData 検索に使うデータ
 type SearchData struct {
-	Type          string
-	TypeName      string
-	Location      []float64
-	LocationName  string
-	UserID        string
-	ReplyToken    string
-	SelectMessage *linebot.ButtonsTemplate
+	Type         string
+	TypeName     string
+	Types        []string
+	Selected     []string
+	Location     []float64
+	LocationName string
+	Bounds       []float64
+	// Rerun 履歴から同じ条件で検索し直すときの条件．nil であればプロフィールの範囲と絞り込みを使う
+	Rerun      *SearchHistory
+	UserID     string
+	ReplyToken string
 }
 
+// errNoBubbles 検索結果の店の詳細を1つも取得できなかったことを表す
+var errNoBubbles = errors.New("no shop details could be fetched")
+
 // BubbleData バブル
 type BubbleData struct {
 	ID     int
 	Bubble *Bubble
 }
 
-// ClickLocker 次の10件を検索するを何回押したかカウントする
-type ClickLocker struct {
-	counter int
+func initializeSearchData() *SearchData {
+	return &SearchData{}
 }
 
-func (cc *ClickLocker) nowCount() int {
-	return cc.counter
+// searchProfile 検索に使うプロフィールを返す．履歴から検索し直すときは履歴の範囲と絞り込みにする
+func (sd *SearchData) searchProfile() UserProfile {
+	profile := store.profile(sd.UserID)
+	if rerun := sd.Rerun; rerun != nil {
+		profile.Filters = rerun.Filters
+		profile.Radius = rerun.Range.Radius
+		profile.RankBy = rerun.Range.RankBy
+	}
+	return profile
 }
 
-func (cc *ClickLocker) inclement() {
-	cc.counter++
-}
+// setCategories 検索する店の種類を設定する
+func (sd *SearchData) setCategories(categories []CategoryConfig) {
+	var keys, names []string
+	for _, category := range categories {
+		keys = append(keys, category.Key)
+		names = append(names, category.Name)
+	}
 
-func (cc *ClickLocker) reset() {
-	cc.counter = 0
+	sd.Type = keys[0]
+	sd.TypeName = strings.Join(names, "・")
+	sd.Types = keys
+	sd.Selected = nil
 }
 
-func initializeSearchData() *SearchData {
-	return &SearchData{
-		SelectMessage: &linebot.ButtonsTemplate{
-			Text: "検索する店の種類を選んで下さい",
-			Actions: []linebot.TemplateAction{
-				&linebot.PostbackAction{
-					Label: "古着屋",
-					Data:  "used",
-				},
-				&linebot.PostbackAction{
-					Label: "セレクトショップ",
-					Data:  "select",
-				},
-				&linebot.PostbackAction{
-					Label: "その他の衣料品店",
-					Data:  "other",
-				},
-				&linebot.PostbackAction{
-					Label: "カフェ",
-					Data:  "cafe",
-				},
-			},
-		},
+func main() {
+	conf, err := loadConfig(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
 	}
-}
+	setConfig(conf)
 
-func main() {
 	bot, err := linebot.New(
-		os.Getenv("CHANNEL_SECRET"),
-		os.Getenv("CHANNEL_TOKEN"),
+		conf.ChannelSecret,
+		conf.ChannelToken,
 	)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	newClient()
+	if err := newClient(conf.GCPAPIKey); err != nil {
+		log.Fatal(err)
+	}
+	if err := checkCredentials(bot); err != nil {
+		log.Fatal(err)
+	}
+
+	warnEphemeralStore(conf.StorePath)
+	store, err = openStore(conf.StorePath)
+	if err != nil {
+		log.Fatalf("failed to open store %s: %v", conf.StorePath, err)
+	}
+
+	codec = newPostbackCodec(conf.ChannelSecret)
+	alerter = newAlerter(bot, conf)
+	watchConfig(os.Args[1:])
+	sweepUserLimiters()
 
-	shopData := &ShopData{}
-	searchData := initializeSearchData()
-	clickLocker := new(ClickLocker)
+	router.use(recoverPanic, logEvent, rateLimit, withSession)
+
+	http.HandleFunc(mapImagePath, serveMapImage)
 
 	// Setup HTTP Server for receiving requests from LINE platform
 	http.HandleFunc("/callback", func(w http.ResponseWriter, req *http.Request) {
@@ -121,85 +141,69 @@ func main() {
 			return
 		}
 		for _, event := range events {
-			searchData.UserID = event.Source.UserID
-			searchData.ReplyToken = event.ReplyToken
-
-			if event.Type == linebot.EventTypeMessage {
-				switch message := event.Message.(type) {
-				case *linebot.TextMessage:
-					searchData.Location = getGeometryLocation(message.Text)
-					searchData.LocationName = message.Text
-
-					if len(searchData.Location) > 0 {
-					} else {
-						if _, err = bot.ReplyMessage(event.ReplyToken, linebot.NewTextMessage("入力された地名が見つかりません")).Do(); err != nil {
-							log.Print(err)
-						}
-						return
-					}
-
-				case *linebot.LocationMessage:
-					searchData.Location = []float64{message.Latitude, message.Longitude}
-					searchData.LocationName = message.Address
-				}
-			}
-			if event.Type == linebot.EventTypePostback {
-				switch data := event.Postback.Data; data {
-				case "next":
-					searchData.Type = data
-
-				case "used":
-					searchData.Type = data
-					searchData.TypeName = "古着屋"
-
-				case "select":
-					searchData.Type = data
-					searchData.TypeName = "セレクトショップ"
-				case "other":
-					searchData.Type = data
-					searchData.TypeName = "その他の衣料品店"
-				case "cafe":
-					searchData.Type = data
-					searchData.TypeName = "カフェ"
-				}
-			}
-		}
-
-		clickLocker.inclement()
-		if clickLocker.nowCount() == 1 {
-			shopData, searchData = startSearchOrSendMessage(bot, shopData, searchData)
-			clickLocker.reset()
+			router.dispatch(bot, event)
 		}
 	})
 	// This is just sample code.
 	// For actual use, you must support HTTPS by using `ListenAndServeTLS`, a reverse proxy or something else.
-	if err := http.ListenAndServe(":"+os.Getenv("PORT"), nil); err != nil {
+	if err := http.ListenAndServe(":"+conf.Port, nil); err != nil {
 		log.Fatal(err)
 	}
 }
 
+// continueSearch セッションの検索状態に応じて検索を開始するか次の行動を促す
+func continueSearch(ctx *EventContext) {
+	session := ctx.Session
+	session.ShopData, session.SearchData = startSearchOrSendMessage(ctx.Bot, ctx.Config, session.ShopData, session.SearchData, ctx.recentPlaces())
+}
+
 // startSearchOrSendMessage 検索を開始するもしくは次の行動を促すメッセージを送信する
-func startSearchOrSendMessage(bot *linebot.Client, shopData *ShopData, searchData *SearchData) (*ShopData, *SearchData) {
+func startSearchOrSendMessage(bot *linebot.Client, conf *Config, shopData *ShopData, searchData *SearchData, recent []RecentPlace) (*ShopData, *SearchData) {
 	var situationMessage, nextActionMessage linebot.SendingMessage
 
 	switch {
-	case searchData.Type == "next":
-		shopData = executeNextAction(bot, shopData, searchData)
+	case searchData.Type == actionNext:
+		shopData = executeNextAction(bot, conf, shopData, searchData)
 		searchData = initializeSearchData()
 		return shopData, searchData
 
+	case len(searchData.Location) > 0 && len(searchData.Type) > 0 && !searchData.searchProfile().hasSearchRange():
+		situationMessage = linebot.NewTextMessage("種類： " + searchData.TypeName + "\n場所: " + searchData.LocationName)
+		nextActionMessage = linebot.NewTextMessage("検索する範囲と並び順を選んで下さい\n(次回からはこの条件で検索します)")
+		if _, err := bot.PushMessage(searchData.UserID, situationMessage, nextActionMessage.WithQuickReplies(searchRangeQuickReplies(conf.RadiusOptions, SearchRange{}))).Do(); err != nil {
+			log.Print(err)
+		}
+		return &ShopData{}, searchData
+
 	case len(searchData.Location) > 0 && len(searchData.Type) > 0:
-		if _, err := bot.PushMessage(searchData.UserID, linebot.NewTextMessage("種類： "+searchData.TypeName+"\n場所: "+searchData.LocationName), linebot.NewTextMessage("上記内容で検索します")).Do(); err != nil {
+		profile := searchData.searchProfile()
+		searchRange := profile.searchRange().describe()
+		if len(searchData.Bounds) > 0 {
+			searchRange = profile.searchRange().describeArea()
+		}
+		summary := "種類： " + searchData.TypeName + "\n場所: " + searchData.LocationName + "\n範囲: " + searchRange
+		if preference := conf.describeProfile(profile); len(preference) > 0 {
+			summary += "\n好み: " + preference
+		}
+		if filters := profile.Filters.describe(); len(filters) > 0 {
+			summary += "\n絞り込み: " + filters
+		}
+		if _, err := bot.PushMessage(searchData.UserID, linebot.NewTextMessage(summary), linebot.NewTextMessage("上記内容で検索します")).Do(); err != nil {
 			log.Print(err)
 		}
 
-		shopData = buildAndSendFlexMessage(searchData.Location, searchData.Type, searchData.ReplyToken)
-		searchData = initializeSearchData()
+		var found bool
+		shopData, found = buildAndSendFlexMessage(bot, conf, searchData, profile)
+		// 見つからなかったときは，提案した種類や場所に変えて検索し直せるよう条件を残す．履歴の範囲と絞り込みは次の検索に持ち越さない
+		searchData.Rerun = nil
+		if found {
+			searchData = initializeSearchData()
+		}
 		return shopData, searchData
 
 	case len(searchData.Location) > 0 && len(searchData.Type) == 0:
 		situationMessage = linebot.NewTextMessage("種類： " + searchData.TypeName + "\n場所: " + searchData.LocationName)
-		nextActionMessage = linebot.NewTemplateMessage("検索する店の種類を選んで下さい", searchData.SelectMessage)
+		nextActionMessage = categoryPickerMessage(conf.Categories, searchData.Selected, 0)
 
 	case len(searchData.Location) == 0 && len(searchData.Type) > 0:
 		situationMessage = linebot.NewTextMessage("種類： " + searchData.TypeName + "\n場所: " + searchData.LocationName)
@@ -207,6 +211,7 @@ func startSearchOrSendMessage(bot *linebot.Client, shopData *ShopData, searchDat
 	}
 
 	shopData = &ShopData{}
+	nextActionMessage = nextActionMessage.WithQuickReplies(promptQuickReplies(searchData, recent))
 	if _, err := bot.PushMessage(searchData.UserID, situationMessage, nextActionMessage).Do(); err != nil {
 		log.Print(err)
 	}
@@ -215,7 +220,7 @@ func startSearchOrSendMessage(bot *linebot.Client, shopData *ShopData, searchDat
 }
 
 // executeNextAction 次の10件を検索する
-func executeNextAction(bot *linebot.Client, shopData *ShopData, searchData *SearchData) *ShopData {
+func executeNextAction(bot *linebot.Client, conf *Config, shopData *ShopData, searchData *SearchData) *ShopData {
 	if reflect.ValueOf(shopData.NextShops).IsNil() && len(shopData.NextPageToken) == 0 {
 		if _, err := bot.PushMessage(searchData.UserID, linebot.NewTextMessage("検索できません．検索場所，検索対象を入力して下さい")).Do(); err != nil {
 			log.Print(err)
@@ -226,7 +231,16 @@ func executeNextAction(bot *linebot.Client, shopData *ShopData, searchData *Sear
 			log.Print(err)
 		}
 
-		shopData = buildAndSendNextFlexMessage(shopData, searchData.ReplyToken)
+		nextShopData, err := buildAndSendNextFlexMessage(conf, shopData, searchData.ReplyToken)
+		if err != nil {
+			// 同じ続きをもう一度検索できるよう，検索結果は差し替えない
+			reportError("next search", searchData.UserID, err)
+			if _, err := bot.ReplyMessage(searchData.ReplyToken, linebot.NewTextMessage(apologyText)).Do(); err != nil {
+				log.Print(err)
+			}
+			return shopData
+		}
+		shopData = nextShopData
 
 		if reflect.ValueOf(shopData.NextShops).IsNil() && len(shopData.NextPageToken) == 0 {
 			if _, err := bot.PushMessage(searchData.UserID, linebot.NewTextMessage("最大検索数に達したため，検索を終了します")).Do(); err != nil {
@@ -238,96 +252,242 @@ func executeNextAction(bot *linebot.Client, shopData *ShopData, searchData *Sear
 	return shopData
 }
 
-// buildAndSendFlexMessage FlexMessageを構築し，送信する
-func buildAndSendFlexMessage(location []float64, shopType string, replyToken string) *ShopData {
-	shopData, nextPageToken := getShopData(location, shopType)
+// buildAndSendFlexMessage FlexMessageを構築し，送信する．店が少なければ検索範囲を広げて検索し直し，
+// それでも見つからなければ近い種類や最寄りの町を提案する．店が見つかったかどうかも返す
+func buildAndSendFlexMessage(bot *linebot.Client, conf *Config, searchData *SearchData, profile UserProfile) (*ShopData, bool) {
+	userID, replyToken := searchData.UserID, searchData.ReplyToken
+	categories := conf.categories(searchData.Types)
+	if len(categories) == 0 {
+		log.Printf("unknown shop types %q", searchData.Types)
+		return &ShopData{}, false
+	}
+
+	var keywords []string
+	for _, category := range categories {
+		keywords = append(keywords, conf.query(category, profile))
+	}
+
+	query := SearchQuery{
+		Origin:   searchData.Location,
+		Bounds:   searchData.Bounds,
+		Category: categories[0],
+		Range:    profile.searchRange(),
+		Filters:  profile.Filters,
 
-	return sendMessageAndBuildShopData(shopData, replyToken, nextPageToken)
+		TravelMode:   profile.travelMode(),
+		LocationName: searchData.LocationName,
+		Favorites:    profile.favoritesByPlaceID(),
+	}
+	query.Explain = query.Range.RankBy == rankByScore && isAdmin(conf, userID)
+	entry := newSearchHistory(query, categories)
+
+	started := time.Now()
+	shops, nextPageToken, scores, err := searchCategories(conf, query, categories, keywords)
+	for step := 0; err == nil && conf.Expansion.allows(query, step, started) && len(nextPageToken) == 0 && countShops(shops) < conf.Expansion.MinResults; step++ {
+		radius, ok := conf.Expansion.next(query.Range)
+		if !ok {
+			break
+		}
+		log.Printf("only %d shops within %dm, expanding to %dm", countShops(shops), query.Range.effectiveRadius(), radius)
+		query.Range.Radius = radius
+		shops, nextPageToken, scores, err = searchCategories(conf, query, categories, keywords)
+	}
+	if err != nil {
+		reportError("search", userID, err)
+		if _, err := bot.ReplyMessage(replyToken, linebot.NewTextMessage(apologyText)).Do(); err != nil {
+			log.Print(err)
+		}
+		return &ShopData{}, false
+	}
+
+	if len(shops[0]) == 0 {
+		if _, err := bot.ReplyMessage(replyToken, noResultMessage(conf, query, categories, keywords)).Do(); err != nil {
+			log.Print(err)
+		}
+		return &ShopData{}, false
+	}
+	if query.Range != profile.searchRange() {
+		if _, err := bot.PushMessage(userID, linebot.NewTextMessage("周辺のお店が少なかったため，範囲を"+formatDistance(query.Range.Radius)+"以内に広げて検索しました")).Do(); err != nil {
+			log.Print(err)
+		}
+	}
+
+	shopData, err := sendSearchResults(conf, userID, entry, shops, query, replyToken, nextPageToken)
+	if err != nil {
+		reportError("search", userID, err)
+		if _, err := bot.ReplyMessage(replyToken, linebot.NewTextMessage(apologyText)).Do(); err != nil {
+			log.Print(err)
+		}
+		return &ShopData{}, false
+	}
+	shopData.Query = query
+	shopData.Scores = scores
+
+	return shopData, true
+}
+
+// searchCategories 検索条件に応じた方法で店の種類を検索し，結果一覧と次の20件にアクセスするトークンとスコアの内訳を返す
+func searchCategories(conf *Config, query SearchQuery, categories []CategoryConfig, keywords []string) ([][]maps.PlacesSearchResult, string, map[string]ScoreBreakdown, error) {
+	var shops [][]maps.PlacesSearchResult
+	var nextPageToken string
+	var scores map[string]ScoreBreakdown
+	var err error
+
+	switch {
+	case query.isAreaSearch():
+		shops, scores, err = getAreaShopData(conf, query, categories, keywords)
+	case query.Range.RankBy == rankByScore:
+		shops, scores, err = getRankedShopData(conf, query, categories, keywords)
+	case len(categories) == 1:
+		shops, nextPageToken, err = getShopData(query, keywords[0], conf.PageSize)
+	default:
+		shops, err = getShopDataForCategories(query, categories, keywords, conf.PageSize)
+	}
+
+	return shops, nextPageToken, scores, err
 }
 
 // buildAndSendNextFlexMessage 次の10件のFlexMessageを構築し，送信する
-func buildAndSendNextFlexMessage(shopData *ShopData, replyToken string) *ShopData {
-	if reflect.ValueOf(shopData.NextShops).IsNil() {
-		shopData, nextPageToken := getNextShops(shopData.NextPageToken)
+func buildAndSendNextFlexMessage(conf *Config, shopData *ShopData, replyToken string) (*ShopData, error) {
+	results, nextPageToken, err := fillPage(shopData.NextShops, shopData.NextPageToken, shopData.Query, conf.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	shops := splitShops(results, conf.PageSize)
 
-		return sendMessageAndBuildShopData(shopData, replyToken, nextPageToken)
+	nextShopData, err := sendMessageAndBuildShopData(conf, shops, shopData.Query, replyToken, nextPageToken)
+	if err != nil {
+		return nil, err
 	}
+	nextShopData.Query = shopData.Query
+	nextShopData.Scores = shopData.Scores
 
-	shops := [][]maps.PlacesSearchResult{shopData.NextShops, nil}
+	return nextShopData, nil
+}
 
-	return sendMessageAndBuildShopData(shops, replyToken, shopData.NextPageToken)
+// sendSearchResults 検索結果の最初のページを送り，検索条件を履歴に残す．種類，エリア，自由な言葉のどの検索もここを通る
+func sendSearchResults(conf *Config, userID string, entry SearchHistory, shops [][]maps.PlacesSearchResult, query SearchQuery, replyToken string, nextPageToken string) (*ShopData, error) {
+	shopData, err := sendMessageAndBuildShopData(conf, shops, query, replyToken, nextPageToken)
+	if err != nil {
+		return nil, err
+	}
+	recordHistory(userID, entry)
+
+	return shopData, nil
 }
 
-// sendMessageAndBuildShopData FlexMessageを構築し，送信する
-func sendMessageAndBuildShopData(shopData [][]maps.PlacesSearchResult, replyToken string, nextPageToken string) *ShopData {
-	bubbles := getBubbles(shopData[0], nextPageToken)
-	sendFlexMessage(bubbles, replyToken)
+// sendMessageAndBuildShopData FlexMessageを構築し，送信する．どの店の詳細も取得できなければ送らずにエラーを返す
+func sendMessageAndBuildShopData(conf *Config, shopData [][]maps.PlacesSearchResult, query SearchQuery, replyToken string, nextPageToken string) (*ShopData, error) {
+	travels := estimateTravels(conf.Travel, query.Origin, shopData[0])
+	bubbles, err := getBubbles(conf, shopData[0], nextPageToken, query, travels)
+	if err != nil {
+		return nil, err
+	}
+	if len(shopData[0]) > 0 {
+		if mapURL := mapImages.add(conf.PublicURL, overviewMapRequest(query.Origin, shopData[0])); len(mapURL) > 0 {
+			bubbles = append([]*Bubble{getOverviewMapBubble(mapURL)}, bubbles...)
+		}
+	}
+	hasNext := !(reflect.ValueOf(shopData[1]).IsNil() && len(nextPageToken) == 0)
+
+	altText := "検索結果"
+	if summary := travelSummary(shopData[0], travels, conf.Travel.Groups); len(summary) > 0 {
+		altText += " (" + summary + ")"
+	}
+	sendFlexMessage(conf, bubbles, altText, replyToken, resultQuickReplies(hasNext))
 
 	return &ShopData{
 		NextShops:     shopData[1],
 		NextPageToken: nextPageToken,
-	}
+	}, nil
 }
 
-// getBubbles FlexMessageを構成するバブルを構築する
-func getBubbles(shopData []maps.PlacesSearchResult, nextPageToken string) []*Bubble {
-	var bubbles = make([]*Bubble, 10)
-	bubbleChannel := make(chan BubbleData, 10)
+// getBubbles FlexMessageを構成するバブルを構築する．店があるのに1つも構築できなければエラーを返す
+func getBubbles(conf *Config, shopData []maps.PlacesSearchResult, nextPageToken string, query SearchQuery, travels map[string]Travel) ([]*Bubble, error) {
+	var bubbles = make([]*Bubble, len(shopData))
+	bubbleChannel := make(chan BubbleData, len(shopData))
 	defer close(bubbleChannel)
 
-	fmt.Println(len(shopData))
-
 	for index, shop := range shopData {
 		go func(index int, shop maps.PlacesSearchResult) {
-			getBubbleData(bubbleChannel, index, shop)
+			getBubbleData(conf, bubbleChannel, index, shop, query, travels[shop.PlaceID], markerLabel(index))
 		}(index, shop)
 	}
 
-	for i := 0; i < 10; i++ {
+	for range shopData {
 		bubble := <-bubbleChannel
 		bubbles[bubble.ID] = bubble.Bubble
 	}
+	bubbles = removeNilBubbles(bubbles)
+	if len(shopData) > 0 && len(bubbles) == 0 {
+		return nil, errNoBubbles
+	}
 
 	if !(reflect.ValueOf(shopData).IsNil() && len(nextPageToken) == 0) {
 		bubbles = append(bubbles, getNextActionBubble())
 	}
 
-	return bubbles
+	return bubbles, nil
 }
 
-func getBubbleData(bubbleChannel chan BubbleData, index int, shop maps.PlacesSearchResult) {
-	shopDetail := getPlaceDetails(shop.PlaceID)
-	photo := getPlacePhotos(shopDetail.Photos)
-	bubble := getBubble(shopDetail, photo)
+// getBubbleData 店のバブルを構築してチャネルに送る．失敗した場合は空のバブルを送る
+func getBubbleData(conf *Config, bubbleChannel chan BubbleData, index int, shop maps.PlacesSearchResult, query SearchQuery, travel Travel, label string) {
+	defer recoverJob("getBubbleData", func() {
+		bubbleChannel <- BubbleData{ID: index}
+	})
+
+	shopDetail, err := getPlaceDetails(shop.PlaceID)
+	if err != nil {
+		reportError("getBubbleData", shop.PlaceID, err)
+		bubbleChannel <- BubbleData{ID: index}
+		return
+	}
+	photo := getPlacePhotos(conf.GCPAPIKey, shopDetail.Photos)
+	bubble := getBubble(shopDetail, photo, conf, query, travel, label)
 	bubbleChannel <- BubbleData{
 		ID:     index,
 		Bubble: bubble,
 	}
 }
 
+// removeNilBubbles 構築に失敗したバブルを取り除く
+func removeNilBubbles(bubbles []*Bubble) []*Bubble {
+	var result []*Bubble
+	for _, bubble := range bubbles {
+		if bubble != nil {
+			result = append(result, bubble)
+		}
+	}
+	return result
+}
+
 // sendFlexMessage http.Clientを利用してFlexMessageを送る
-func sendFlexMessage(bubbles []*Bubble, replyToken string) {
-	req, err := buildRequest(bubbles, replyToken)
+func sendFlexMessage(conf *Config, bubbles []*Bubble, altText string, replyToken string, quickReply *linebot.QuickReplyItems) {
+	req, err := buildRequest(conf.ChannelToken, bubbles, altText, replyToken, quickReply)
 	if err != nil {
-		fmt.Println(err.Error())
+		log.Printf("building flex message %q failed: %v", altText, err)
+		return
 	}
 
 	client := new(http.Client)
 	res, err := client.Do(req)
 	if err != nil {
-		fmt.Println(err.Error())
+		log.Printf("sending flex message %q failed: %v", altText, err)
+		return
 	}
 	defer res.Body.Close()
 
-	dumpResp, _ := httputil.DumpResponse(res, true)
-	fmt.Printf("%s\n\n", dumpResp)
+	if res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		log.Printf("sending flex message %q failed: %s: %s", altText, res.Status, body)
+	}
 }
 
-// buildRequest リクエストを構築する
-func buildRequest(bubbles []*Bubble, replyToken string) (*http.Request, error) {
-	message, err := json.Marshal(getFlexMessage(bubbles, replyToken))
+// buildRequest チャネルアクセストークンで認証するリクエストを構築する
+func buildRequest(channelToken string, bubbles []*Bubble, altText string, replyToken string, quickReply *linebot.QuickReplyItems) (*http.Request, error) {
+	message, err := json.Marshal(getFlexMessage(bubbles, altText, replyToken, quickReply))
 	if err != nil {
-		fmt.Println(err.Error())
+		return nil, err
 	}
 
 	req, err := http.NewRequest("POST", "https://api.line.me/v2/bot/message/reply", bytes.NewReader(message))
@@ -336,7 +496,7 @@ func buildRequest(bubbles []*Bubble, replyToken string) (*http.Request, error) {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer {"+os.Getenv("CHANNEL_TOKEN")+"}")
+	req.Header.Set("Authorization", "Bearer {"+channelToken+"}")
 
 	return req, nil
 }
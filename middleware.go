@@ -0,0 +1,163 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// userRateInterval ユーザごとに許可するイベントの間隔
+	userRateInterval = time.Second
+	// userRateBurst ユーザごとに連続で許可するイベント数
+	userRateBurst = 5
+	// userLimiterTTL この時間イベントのないユーザのレートリミッタは破棄する
+	userLimiterTTL = 10 * time.Minute
+)
+
+// recoverPanic ハンドラ内のpanicを回復し，ユーザへの謝罪と管理者への通知を行う
+func recoverPanic(next HandlerFunc) HandlerFunc {
+	return func(ctx *EventContext) {
+		defer func() {
+			if r := recover(); r != nil {
+				reportPanic(string(ctx.Event.Type)+" handler", ctx.eventID(), r)
+
+				if len(ctx.userID()) == 0 {
+					return
+				}
+				if _, err := ctx.Bot.PushMessage(ctx.userID(), linebot.NewTextMessage(apologyText)).Do(); err != nil {
+					log.Print(err)
+				}
+			}
+		}()
+
+		next(ctx)
+	}
+}
+
+// logEvent イベントの種類と処理時間をログに出す
+func logEvent(next HandlerFunc) HandlerFunc {
+	return func(ctx *EventContext) {
+		start := time.Now()
+		next(ctx)
+		log.Printf("handled %s event from %s in %s", ctx.Event.Type, ctx.userID(), time.Since(start))
+	}
+}
+
+// userLimiter ユーザのレートリミッタと最後にイベントが届いた時刻
+type userLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// userLimiters ユーザIDごとのレートリミッタ
+var userLimiters = struct {
+	sync.Mutex
+	limiters map[string]*userLimiter
+}{limiters: map[string]*userLimiter{}}
+
+// rateLimit ユーザごとに一定以上の頻度で届いたイベントを破棄する
+func rateLimit(next HandlerFunc) HandlerFunc {
+	return func(ctx *EventContext) {
+		userLimiters.Lock()
+		ul, ok := userLimiters.limiters[ctx.userID()]
+		if !ok {
+			limit := ctx.Config.RateLimit
+			ul = &userLimiter{limiter: rate.NewLimiter(rate.Every(time.Duration(limit.Interval)), limit.Burst)}
+			userLimiters.limiters[ctx.userID()] = ul
+		}
+		ul.lastSeen = time.Now()
+		limiter := ul.limiter
+		userLimiters.Unlock()
+
+		if !limiter.Allow() {
+			log.Printf("rate limited %s event from %s", ctx.Event.Type, ctx.userID())
+			return
+		}
+
+		next(ctx)
+	}
+}
+
+// resetUserLimiters 設定変更を反映するため，ユーザごとのレートリミッタを破棄する
+func resetUserLimiters() {
+	userLimiters.Lock()
+	defer userLimiters.Unlock()
+
+	userLimiters.limiters = map[string]*userLimiter{}
+}
+
+// sweepUserLimiters しばらくイベントのないユーザのレートリミッタを定期的に破棄し，使われなくなったリミッタが溜まらないようにする
+func sweepUserLimiters() {
+	go func() {
+		defer recoverJob("sweepUserLimiters", nil)
+
+		for range time.Tick(userLimiterTTL) {
+			if evicted := evictIdleLimiters(time.Now().Add(-userLimiterTTL)); evicted > 0 {
+				log.Printf("evicted %d idle rate limiters", evicted)
+			}
+		}
+	}()
+}
+
+// evictIdleLimiters 指定した時刻より後にイベントのないユーザのレートリミッタを破棄し，その数を返す
+func evictIdleLimiters(before time.Time) int {
+	userLimiters.Lock()
+	defer userLimiters.Unlock()
+
+	evicted := 0
+	for userID, ul := range userLimiters.limiters {
+		if ul.lastSeen.Before(before) {
+			delete(userLimiters.limiters, userID)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// withSession ユーザのセッションを排他的に確保してハンドラに渡す．検索中に届いたイベントは処理中であることを返して破棄する
+func withSession(next HandlerFunc) HandlerFunc {
+	return func(ctx *EventContext) {
+		session := sessions.get(ctx.userID())
+		if !session.mu.TryLock() {
+			log.Printf("dropped %s event from %s while searching", ctx.Event.Type, ctx.userID())
+			if len(ctx.Event.ReplyToken) > 0 {
+				ctx.reply(linebot.NewTextMessage("処理中です．検索が終わってからもう一度お試し下さい"))
+			}
+			return
+		}
+		defer session.mu.Unlock()
+
+		session.SearchData.UserID = ctx.userID()
+		session.SearchData.ReplyToken = ctx.Event.ReplyToken
+		ctx.Session = session
+
+		next(ctx)
+	}
+}
+
+// adminOnly 管理者以外からのイベントを拒否する
+func adminOnly(next HandlerFunc) HandlerFunc {
+	return func(ctx *EventContext) {
+		if !isAdmin(ctx.Config, ctx.userID()) {
+			log.Printf("denied admin-only %s event from %s", ctx.Event.Type, ctx.userID())
+			ctx.reply(linebot.NewTextMessage("この操作は管理者のみ実行できます"))
+			return
+		}
+
+		next(ctx)
+	}
+}
+
+// isAdmin ユーザが管理者か判定する
+func isAdmin(conf *Config, userID string) bool {
+	for _, id := range conf.AdminUserIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestEvictIdleLimiters(t *testing.T) {
+	resetUserLimiters()
+	defer resetUserLimiters()
+
+	now := time.Now()
+	userLimiters.limiters["idle"] = &userLimiter{limiter: rate.NewLimiter(rate.Every(time.Second), 1), lastSeen: now.Add(-2 * userLimiterTTL)}
+	userLimiters.limiters["active"] = &userLimiter{limiter: rate.NewLimiter(rate.Every(time.Second), 1), lastSeen: now}
+
+	if evicted := evictIdleLimiters(now.Add(-userLimiterTTL)); evicted != 1 {
+		t.Errorf("evictIdleLimiters() = %d, want 1", evicted)
+	}
+	if _, ok := userLimiters.limiters["idle"]; ok {
+		t.Error("idle limiter was not evicted")
+	}
+	if _, ok := userLimiters.limiters["active"]; !ok {
+		t.Error("active limiter was evicted")
+	}
+}
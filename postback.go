@@ -0,0 +1,191 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	// postbackVersion ポストバックデータのスキーマバージョン
+	postbackVersion = 1
+	// postbackTTL ポストバックデータの有効期限の既定値
+	postbackTTL = 24 * time.Hour
+	// postbackMaxLength LINEが受け付けるポストバックデータの最大長
+	postbackMaxLength = 300
+	// postbackTagLength HMACタグのバイト数
+	postbackTagLength = 16
+)
+
+// ポストバックのアクション名
+const (
+	actionCategory       = "category"
+	actionToggleCategory = "toggle"
+	actionSearchSelected = "selected"
+	actionPicker         = "picker"
+	actionNext           = "next"
+	actionRecentPlace    = "recent"
+	actionChangeLocation = "location"
+	actionChangeCategory = "change"
+	actionCancel         = "cancel"
+	actionPreference     = "pref"
+	actionGender         = "gender"
+	actionStyle          = "style"
+	actionClearStyles    = "nostyle"
+	actionRangeMenu      = "ranges"
+	actionRange          = "range"
+	actionFilterMenu     = "filters"
+	actionFilter         = "filter"
+	actionClearFilters   = "nofilter"
+	actionExplainRank    = "explain"
+	actionTravelModeMenu = "modes"
+	actionTravelMode     = "mode"
+	actionRoute          = "route"
+	actionPlaceCandidate = "candidate"
+	actionConfirmPlace   = "confirm"
+	actionSkipConfirm    = "noconfirm"
+	actionToggleConfirm  = "askconfirm"
+	actionAddFavorite    = "fav"
+	actionRemoveFavorite = "unfav"
+	actionFavorites      = "favs"
+	actionFavoriteMenu   = "favmenu"
+	actionMoveFavorite   = "favmove"
+	actionNewList        = "newlist"
+	actionEditNote       = "favnote"
+	actionClearNote      = "nonote"
+	actionHistory        = "history"
+	actionRerun          = "rerun"
+	actionClearHistory   = "nohistory"
+)
+
+var (
+	errPostbackFormat    = errors.New("postback: malformed data")
+	errPostbackVersion   = errors.New("postback: unsupported version")
+	errPostbackSignature = errors.New("postback: invalid signature")
+	errPostbackExpired   = errors.New("postback: expired")
+	errPostbackTooLong   = errors.New("postback: data too long")
+)
+
+// codec ポストバックデータの符号化・復号に使う
+var codec *PostbackCodec
+
+// PostbackData ポストバックで受け渡すアクションとパラメータ
+type PostbackData struct {
+	Version  int               `json:"v"`
+	Action   string            `json:"a"`
+	Category string            `json:"c,omitempty"`
+	Page     int               `json:"p,omitempty"`
+	PlaceID  string            `json:"i,omitempty"`
+	Name     string            `json:"n,omitempty"`
+	Location []float64         `json:"l,omitempty"`
+	Bounds   []float64         `json:"b,omitempty"`
+	Filters  map[string]string `json:"f,omitempty"`
+	Entry    int64             `json:"e,omitempty"`
+	IssuedAt int64             `json:"t"`
+}
+
+// roundCoordinates 緯度・経度をポストバックに載せられるよう小数点以下6桁(約10cm)に丸める
+func roundCoordinates(values []float64) []float64 {
+	var rounded []float64
+	for _, v := range values {
+		rounded = append(rounded, math.Round(v*1e6)/1e6)
+	}
+	return rounded
+}
+
+// placePostback 場所を選ぶポストバックデータを構築する．上限に収まるよう座標を丸め，名前を切り詰める
+func placePostback(action, name string, location, bounds []float64) PostbackData {
+	return PostbackData{
+		Action:   action,
+		Name:     truncate(name, quickReplyLabelLength),
+		Location: roundCoordinates(location),
+		Bounds:   roundCoordinates(bounds),
+	}
+}
+
+// PostbackCodec チャネルシークレットから導出した鍵でポストバックデータに署名・検証する
+type PostbackCodec struct {
+	key []byte
+	now func() time.Time
+}
+
+// newPostbackCodec チャネルシークレットからポストバックの署名鍵を導出し，codecを生成
+func newPostbackCodec(channelSecret string) *PostbackCodec {
+	mac := hmac.New(sha256.New, []byte(channelSecret))
+	mac.Write([]byte("postback"))
+
+	return &PostbackCodec{
+		key: mac.Sum(nil),
+		now: time.Now,
+	}
+}
+
+// encode ポストバックデータをバージョンと発行時刻付きで符号化し，署名を付けて返す．
+// LINEの上限より長くなると返信全体が拒否されるため，エラーを返して呼び出し側にデータを小さくさせる
+func (pc *PostbackCodec) encode(data PostbackData) (string, error) {
+	data.Version = postbackVersion
+	data.IssuedAt = pc.now().Unix()
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	raw := encoded + "." + base64.RawURLEncoding.EncodeToString(pc.sign(encoded))
+	if len(raw) > postbackMaxLength {
+		return "", fmt.Errorf("%w: %q is %d bytes, limit is %d", errPostbackTooLong, data.Action, len(raw), postbackMaxLength)
+	}
+
+	return raw, nil
+}
+
+// decode 署名，バージョン，有効期限を検証し，ポストバックデータを復号する
+func (pc *PostbackCodec) decode(raw string, ttl time.Duration) (*PostbackData, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 2 {
+		return nil, errPostbackFormat
+	}
+
+	tag, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errPostbackFormat
+	}
+	if !hmac.Equal(tag, pc.sign(parts[0])) {
+		return nil, errPostbackSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errPostbackFormat
+	}
+
+	var data PostbackData
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return nil, errPostbackFormat
+	}
+	if data.Version != postbackVersion {
+		return nil, errPostbackVersion
+	}
+
+	issuedAt := time.Unix(data.IssuedAt, 0)
+	if pc.now().Sub(issuedAt) > ttl || issuedAt.After(pc.now().Add(time.Minute)) {
+		return nil, errPostbackExpired
+	}
+
+	return &data, nil
+}
+
+// sign 符号化済みのペイロードに対するHMACタグを返す
+func (pc *PostbackCodec) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, pc.key)
+	mac.Write([]byte(encoded))
+
+	return mac.Sum(nil)[:postbackTagLength]
+}
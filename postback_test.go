@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestCodec(now time.Time) *PostbackCodec {
+	pc := newPostbackCodec("secret")
+	pc.now = func() time.Time { return now }
+
+	return pc
+}
+
+// signPayload 任意のJSONに正しい署名を付ける
+func signPayload(pc *PostbackCodec, payload string) string {
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(pc.sign(encoded))
+}
+
+func TestPostbackRoundTrip(t *testing.T) {
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	pc := newTestCodec(now)
+
+	data := PostbackData{
+		Action:   actionConfirmPlace,
+		Name:     "渋谷駅",
+		Location: []float64{35.658034, 139.701636},
+		Filters:  map[string]string{"mode": "walking"},
+		Entry:    42,
+	}
+	raw, err := pc.encode(data)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	got, err := pc.decode(raw, time.Hour)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	data.Version = postbackVersion
+	data.IssuedAt = now.Unix()
+	if !reflect.DeepEqual(*got, data) {
+		t.Errorf("decode = %+v, want %+v", *got, data)
+	}
+}
+
+func TestPostbackDecodeErrors(t *testing.T) {
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	pc := newTestCodec(now)
+
+	valid, err := pc.encode(PostbackData{Action: actionNext, Page: 2})
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	payload, tag := valid[:strings.Index(valid, ".")], valid[strings.Index(valid, ".")+1:]
+
+	tampered := []byte(tag)
+	if tampered[0] == 'A' {
+		tampered[0] = 'B'
+	} else {
+		tampered[0] = 'A'
+	}
+
+	otherKey := newTestCodec(now)
+	otherKey.key = []byte("another key")
+	forged, _ := otherKey.encode(PostbackData{Action: actionNext, Page: 2})
+
+	wrongVersion, _ := json.Marshal(PostbackData{Version: postbackVersion + 1, Action: actionNext, IssuedAt: now.Unix()})
+
+	tests := []struct {
+		name string
+		raw  string
+		want error
+	}{
+		{name: "empty", raw: "", want: errPostbackFormat},
+		{name: "no separator", raw: payload, want: errPostbackFormat},
+		{name: "too many parts", raw: valid + ".x", want: errPostbackFormat},
+		{name: "malformed tag", raw: payload + ".!!!", want: errPostbackFormat},
+		{name: "tampered tag", raw: payload + "." + string(tampered), want: errPostbackSignature},
+		{name: "tampered payload", raw: "e30." + tag, want: errPostbackSignature},
+		{name: "other key", raw: forged, want: errPostbackSignature},
+		{name: "malformed base64", raw: "!!!." + base64.RawURLEncoding.EncodeToString(pc.sign("!!!")), want: errPostbackFormat},
+		{name: "malformed json", raw: signPayload(pc, "{not json"), want: errPostbackFormat},
+		{name: "wrong version", raw: signPayload(pc, string(wrongVersion)), want: errPostbackVersion},
+		{name: "legacy plain text", raw: "category=cafe", want: errPostbackFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := pc.decode(tt.raw, time.Hour); !errors.Is(err, tt.want) {
+				t.Errorf("decode(%q) error = %v, want %v", tt.raw, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostbackExpiry(t *testing.T) {
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	pc := newTestCodec(now)
+
+	raw, err := pc.encode(PostbackData{Action: actionHistory})
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		after time.Duration
+		want  error
+	}{
+		{name: "fresh", after: 0, want: nil},
+		{name: "just within ttl", after: time.Hour, want: nil},
+		{name: "expired", after: time.Hour + time.Second, want: errPostbackExpired},
+		{name: "issued in the future", after: -2 * time.Minute, want: errPostbackExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pc.now = func() time.Time { return now.Add(tt.after) }
+			if _, err := pc.decode(raw, time.Hour); !errors.Is(err, tt.want) {
+				t.Errorf("decode after %v error = %v, want %v", tt.after, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostbackEncodeTooLong(t *testing.T) {
+	pc := newTestCodec(time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC))
+
+	_, err := pc.encode(PostbackData{Action: actionConfirmPlace, Name: strings.Repeat("長い名前", 30)})
+	if !errors.Is(err, errPostbackTooLong) {
+		t.Errorf("encode error = %v, want %v", err, errPostbackTooLong)
+	}
+}
+
+func TestPlacePostbackFitsLimit(t *testing.T) {
+	pc := newTestCodec(time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC))
+
+	data := placePostback(actionPlaceCandidate, strings.Repeat("長", 40),
+		[]float64{-35.65803412345678, -139.70163612345678},
+		[]float64{-35.64912345678901, -139.69212345678901, -35.66712345678901, -139.71112345678901})
+	if got := data.Location; !reflect.DeepEqual(got, []float64{-35.658034, -139.701636}) {
+		t.Errorf("Location = %v, want rounded to 6 decimals", got)
+	}
+
+	raw, err := pc.encode(data)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	t.Logf("worst-case place postback is %d bytes", len(raw))
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UserProfile ユーザごとに保存する好み
+type UserProfile struct {
+	Gender string   `json:"gender,omitempty"`
+	Styles []string `json:"styles,omitempty"`
+	Radius uint     `json:"radius,omitempty"`
+	RankBy string   `json:"rankBy,omitempty"`
+
+	TravelMode  string `json:"travelMode,omitempty"`
+	SkipConfirm bool   `json:"skipConfirm,omitempty"`
+
+	Filters ResultFilters `json:"filters"`
+
+	Favorites []Favorite      `json:"favorites,omitempty"`
+	History   []SearchHistory `json:"history,omitempty"`
+}
+
+// GenderConfig 衣料品の検索で選べる対象
+type GenderConfig struct {
+	Key     string `json:"key"`
+	Name    string `json:"name"`
+	Keyword string `json:"keyword"`
+}
+
+// defaultGenders 衣料品の検索で選べる対象の既定値
+func defaultGenders() []GenderConfig {
+	return []GenderConfig{
+		{Key: "mens", Name: "メンズ", Keyword: "メンズ"},
+		{Key: "ladies", Name: "レディース", Keyword: "レディース"},
+		{Key: "unisex", Name: "ユニセックス", Keyword: "ユニセックス"},
+		{Key: "none", Name: "指定なし"},
+	}
+}
+
+// defaultStyles 衣料品の検索で選べるスタイルの既定値
+func defaultStyles() []string {
+	return []string{"ヴィンテージ", "ストリート", "アメカジ", "モード", "きれいめ"}
+}
+
+// clone 共有されないようにスライスを複製したプロフィールを返す
+func (p *UserProfile) clone() UserProfile {
+	profile := *p
+	profile.Styles = append([]string(nil), p.Styles...)
+	profile.Favorites = append([]Favorite(nil), p.Favorites...)
+	for i := range profile.Favorites {
+		profile.Favorites[i].Tags = append([]string(nil), p.Favorites[i].Tags...)
+	}
+	profile.History = append([]SearchHistory(nil), p.History...)
+	return profile
+}
+
+// toggleStyle スタイルを好みに加える，または外す
+func (p *UserProfile) toggleStyle(style string) {
+	if !contains(p.Styles, style) {
+		p.Styles = append(p.Styles, style)
+		return
+	}
+
+	var styles []string
+	for _, s := range p.Styles {
+		if s != style {
+			styles = append(styles, s)
+		}
+	}
+	p.Styles = styles
+}
+
+// gender キーに対応する対象を返す
+func (c *Config) gender(key string) (GenderConfig, bool) {
+	for _, gender := range c.Genders {
+		if gender.Key == key {
+			return gender, true
+		}
+	}
+	return GenderConfig{}, false
+}
+
+// query 店の種類の検索用語を返す．衣料品の種類ではユーザの対象とスタイルの好みを加える
+func (c *Config) query(category CategoryConfig, profile UserProfile) string {
+	if !category.Gendered {
+		return category.query()
+	}
+
+	var terms []string
+	if gender, ok := c.gender(profile.Gender); ok && len(gender.Keyword) > 0 {
+		terms = append(terms, gender.Keyword)
+	}
+	terms = append(terms, "("+category.query()+")")
+	if len(profile.Styles) > 0 {
+		terms = append(terms, "("+strings.Join(profile.Styles, " || ")+")")
+	}
+
+	if len(terms) == 1 {
+		return category.query()
+	}
+	return strings.Join(terms, " && ")
+}
+
+// describeProfile 検索内容の確認に表示する好みの説明を返す．好みがなければ空文字を返す
+func (c *Config) describeProfile(profile UserProfile) string {
+	var parts []string
+	if gender, ok := c.gender(profile.Gender); ok && len(gender.Keyword) > 0 {
+		parts = append(parts, gender.Name)
+	}
+	parts = append(parts, profile.Styles...)
+
+	return strings.Join(parts, " / ")
+}
+
+// validateGenders 対象とスタイルの設定の問題点を返す
+func validateGenders(genders []GenderConfig, styles []string) []string {
+	var problems []string
+
+	keys := map[string]bool{}
+	for i, gender := range genders {
+		if len(gender.Key) == 0 || len(gender.Name) == 0 {
+			problems = append(problems, fmt.Sprintf("genders[%d]: key and name are required", i))
+		}
+		if keys[gender.Key] {
+			problems = append(problems, fmt.Sprintf("genders[%d]: duplicate key %q", i, gender.Key))
+		}
+		keys[gender.Key] = true
+	}
+
+	for i, style := range styles {
+		if len(strings.TrimSpace(style)) == 0 {
+			problems = append(problems, fmt.Sprintf("styles[%d]: style is empty", i))
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"log"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+const (
+	// maxRecentPlaces クイックリプライに出す最近検索した場所の数
+	maxRecentPlaces = 3
+	// quickReplyLabelLength クイックリプライのラベルの最大文字数
+	quickReplyLabelLength = 20
+)
+
+// RecentPlace 最近検索した場所
+type RecentPlace struct {
+	Name     string
+	Location []float64
+	Bounds   []float64
+}
+
+// recentPlaces 保存した検索履歴から最近検索した場所を新しい順に返す．同じ名前の場所は1つにまとめる
+func (p UserProfile) recentPlaces() []RecentPlace {
+	var places []RecentPlace
+	seen := map[string]bool{}
+	for _, h := range p.History {
+		if len(places) == maxRecentPlaces {
+			break
+		}
+		if len(h.Location) != 2 {
+			continue
+		}
+
+		name := h.LocationName
+		if len(name) == 0 {
+			name = "送った位置情報"
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		places = append(places, RecentPlace{Name: name, Location: h.Location, Bounds: h.Bounds})
+	}
+	return places
+}
+
+// recentPlaces イベントを送ったユーザが最近検索した場所を返す
+func (ctx *EventContext) recentPlaces() []RecentPlace {
+	return store.profile(ctx.userID()).recentPlaces()
+}
+
+// promptQuickReplies 検索条件の入力を促すメッセージに付けるクイックリプライを会話の状態から構築する
+func promptQuickReplies(searchData *SearchData, recent []RecentPlace) *linebot.QuickReplyItems {
+	var buttons []*linebot.QuickReplyButton
+
+	if len(searchData.Location) == 0 {
+		buttons = append(buttons, linebot.NewQuickReplyButton("", linebot.NewLocationAction("現在地を送る")))
+		for _, place := range recent {
+			buttons = append(buttons, postbackQuickReply(place.Name, placePostback(actionRecentPlace, place.Name, place.Location, place.Bounds)))
+		}
+	} else {
+		buttons = append(buttons, postbackQuickReply("場所を変更", PostbackData{Action: actionChangeLocation}))
+	}
+
+	if len(searchData.Type) > 0 {
+		buttons = append(buttons, postbackQuickReply("種類を変更", PostbackData{Action: actionChangeCategory}))
+	}
+	buttons = append(buttons, postbackQuickReply("キャンセル", PostbackData{Action: actionCancel}))
+
+	return quickReplyItems(buttons...)
+}
+
+// resultQuickReplies 検索結果に付けるクイックリプライを構築する
+func resultQuickReplies(hasNext bool) *linebot.QuickReplyItems {
+	var buttons []*linebot.QuickReplyButton
+
+	if hasNext {
+		buttons = append(buttons, postbackQuickReply("次の10件", PostbackData{Action: actionNext}))
+	}
+	buttons = append(buttons,
+		linebot.NewQuickReplyButton("", linebot.NewLocationAction("現在地で探す")),
+		postbackQuickReply("種類を選ぶ", PostbackData{Action: actionPicker}),
+		postbackQuickReply("範囲・並び順", PostbackData{Action: actionRangeMenu}),
+		postbackQuickReply("絞り込み", PostbackData{Action: actionFilterMenu}),
+		postbackQuickReply("移動手段", PostbackData{Action: actionTravelModeMenu}),
+		postbackQuickReply("好みを設定", PostbackData{Action: actionPreference}),
+		postbackQuickReply("履歴", PostbackData{Action: actionHistory}),
+	)
+
+	return quickReplyItems(buttons...)
+}
+
+// postbackQuickReply ポストバックを送るクイックリプライのボタンを構築する．データを符号化できなければ nil を返す
+func postbackQuickReply(label string, data PostbackData) *linebot.QuickReplyButton {
+	label = truncate(label, quickReplyLabelLength)
+	encoded, err := codec.encode(data)
+	if err != nil {
+		log.Printf("dropped %q quick reply: %v", label, err)
+		return nil
+	}
+	return linebot.NewQuickReplyButton("", linebot.NewPostbackAction(label, encoded, "", label))
+}
+
+// quickReplyItems 構築できずに nil になったボタンを除いてクイックリプライにまとめる
+func quickReplyItems(buttons ...*linebot.QuickReplyButton) *linebot.QuickReplyItems {
+	var items []*linebot.QuickReplyButton
+	for _, button := range buttons {
+		if button != nil {
+			items = append(items, button)
+		}
+	}
+	return linebot.NewQuickReplyItems(items...)
+}
+
+// truncate 文字列を指定した文字数までに切り詰める
+func truncate(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	return string(runes[:length-1]) + "…"
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"googlemaps.github.io/maps"
+)
+
+// maxResultWindow Nearby Search で取得できる検索結果の最大数
+const maxResultWindow = 60
+
+// RankingConfig おすすめ順の並べ替えの設定
+type RankingConfig struct {
+	Weights       RankingWeights `json:"weights"`
+	PriorRating   float64        `json:"priorRating"`
+	PriorReviews  float64        `json:"priorReviews"`
+	MaxCandidates int            `json:"maxCandidates"`
+}
+
+// RankingWeights おすすめ順のスコアを構成する各要素の重み
+type RankingWeights struct {
+	Distance float64 `json:"distance"`
+	Rating   float64 `json:"rating"`
+	Reviews  float64 `json:"reviews"`
+	OpenNow  float64 `json:"openNow"`
+}
+
+// ScoreBreakdown 店のおすすめ順のスコアの内訳
+type ScoreBreakdown struct {
+	Name           string
+	Rank           int
+	Score          float64
+	Distance       float64
+	AdjustedRating float64
+	Components     RankingWeights
+	Weights        RankingWeights
+}
+
+// candidate 並べ替えの対象となる店と，その店の種類の重み
+type candidate struct {
+	shop    maps.PlacesSearchResult
+	weights RankingWeights
+}
+
+// defaultRankingConfig おすすめ順の並べ替えの設定の既定値
+func defaultRankingConfig() RankingConfig {
+	return RankingConfig{
+		Weights: RankingWeights{
+			Distance: 1,
+			Rating:   2,
+			Reviews:  1,
+			OpenNow:  0.5,
+		},
+		PriorRating:   3.5,
+		PriorReviews:  20,
+		MaxCandidates: maxResultWindow,
+	}
+}
+
+// weights 店の種類に重みが設定されていればそれを，なければ既定の重みを返す
+func (rc RankingConfig) weights(category CategoryConfig) RankingWeights {
+	if category.Weights != nil {
+		return *category.Weights
+	}
+	return rc.Weights
+}
+
+// getRankedShopData 店の種類ごとに検索結果を集められるだけ集め，おすすめ順に並べた結果一覧とスコアの内訳を返す
+func getRankedShopData(conf *Config, query SearchQuery, categories []CategoryConfig, keywords []string) ([][]maps.PlacesSearchResult, map[string]ScoreBreakdown, error) {
+	var candidates []candidate
+	seen := map[string]bool{}
+
+	for i, category := range categories {
+		categoryQuery := query
+		categoryQuery.Category = category
+
+		shops, nextPageToken, err := searchPlaces(nearbySearchRequest(query, category, keywords[i]), categoryQuery)
+		if err != nil {
+			return nil, nil, err
+		}
+		shops, _, err = fillPage(shops, nextPageToken, categoryQuery, conf.Ranking.MaxCandidates)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, shop := range shops {
+			if !seen[shop.PlaceID] {
+				seen[shop.PlaceID] = true
+				candidates = append(candidates, candidate{shop: shop, weights: conf.Ranking.weights(category)})
+			}
+		}
+	}
+
+	shops, scores := rankShops(candidates, query.Origin, conf.Ranking)
+
+	return splitShops(shops, conf.PageSize), scores, nil
+}
+
+// rankShops 距離，ベイズ補正した評価，口コミ数，営業中かどうかの重み付きの和で店を並べ替える
+func rankShops(candidates []candidate, origin []float64, rc RankingConfig) ([]maps.PlacesSearchResult, map[string]ScoreBreakdown) {
+	var maxDistance float64
+	var maxReviews int
+	for _, c := range candidates {
+		maxDistance = math.Max(maxDistance, distance(origin, c.shop.Geometry.Location))
+		if c.shop.UserRatingsTotal > maxReviews {
+			maxReviews = c.shop.UserRatingsTotal
+		}
+	}
+
+	breakdowns := make([]ScoreBreakdown, len(candidates))
+	for i, c := range candidates {
+		breakdowns[i] = scoreShop(c, origin, rc, maxDistance, maxReviews)
+	}
+
+	order := make([]int, len(candidates))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return breakdowns[order[i]].Score > breakdowns[order[j]].Score
+	})
+
+	shops := make([]maps.PlacesSearchResult, len(candidates))
+	scores := map[string]ScoreBreakdown{}
+	for rank, i := range order {
+		shops[rank] = candidates[i].shop
+		breakdowns[i].Rank = rank + 1
+		scores[candidates[i].shop.PlaceID] = breakdowns[i]
+	}
+
+	return shops, scores
+}
+
+// scoreShop 店のスコアの内訳を計算する．各要素は0から1に正規化する
+func scoreShop(c candidate, origin []float64, rc RankingConfig, maxDistance float64, maxReviews int) ScoreBreakdown {
+	shop := c.shop
+	b := ScoreBreakdown{
+		Name:     shop.Name,
+		Distance: distance(origin, shop.Geometry.Location),
+		Weights:  c.weights,
+	}
+
+	reviews := float64(shop.UserRatingsTotal)
+	b.AdjustedRating = rc.PriorRating
+	if reviews+rc.PriorReviews > 0 {
+		b.AdjustedRating = (reviews*float64(shop.Rating) + rc.PriorRating*rc.PriorReviews) / (reviews + rc.PriorReviews)
+	}
+
+	b.Components.Distance = 1
+	if maxDistance > 0 {
+		b.Components.Distance = 1 - b.Distance/maxDistance
+	}
+	b.Components.Rating = math.Max(0, (b.AdjustedRating-1)/4)
+	if maxReviews > 0 {
+		b.Components.Reviews = math.Log1p(reviews) / math.Log1p(float64(maxReviews))
+	}
+	b.Components.OpenNow = 0.5
+	if shop.OpeningHours != nil && shop.OpeningHours.OpenNow != nil {
+		b.Components.OpenNow = 0
+		if *shop.OpeningHours.OpenNow {
+			b.Components.OpenNow = 1
+		}
+	}
+
+	w := c.weights
+	total := w.Distance + w.Rating + w.Reviews + w.OpenNow
+	if total > 0 {
+		b.Score = (w.Distance*b.Components.Distance + w.Rating*b.Components.Rating + w.Reviews*b.Components.Reviews + w.OpenNow*b.Components.OpenNow) / total
+	}
+
+	return b
+}
+
+// explain スコアの内訳を説明する文章を返す
+func (b ScoreBreakdown) explain() string {
+	lines := []string{
+		fmt.Sprintf("%d位 %s", b.Rank, b.Name),
+		fmt.Sprintf("スコア: %.3f", b.Score),
+		fmt.Sprintf("距離: %.0fm → %.2f × %.1f", b.Distance, b.Components.Distance, b.Weights.Distance),
+		fmt.Sprintf("評価(補正後): %.2f → %.2f × %.1f", b.AdjustedRating, b.Components.Rating, b.Weights.Rating),
+		fmt.Sprintf("口コミ数: %.2f × %.1f", b.Components.Reviews, b.Weights.Reviews),
+		fmt.Sprintf("営業中: %.2f × %.1f", b.Components.OpenNow, b.Weights.OpenNow),
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validate おすすめ順の並べ替えの設定の問題点を返す
+func (rc RankingConfig) validate(categories []CategoryConfig) []string {
+	var problems []string
+
+	problems = append(problems, rc.Weights.validate("ranking.weights")...)
+	for i, category := range categories {
+		if category.Weights != nil {
+			problems = append(problems, category.Weights.validate(fmt.Sprintf("categories[%d].weights", i))...)
+		}
+	}
+	if rc.PriorRating < 1 || rc.PriorRating > 5 {
+		problems = append(problems, "ranking.priorRating must be between 1 and 5")
+	}
+	if rc.PriorReviews < 0 {
+		problems = append(problems, "ranking.priorReviews must not be negative")
+	}
+	if rc.MaxCandidates <= 0 || rc.MaxCandidates > maxResultWindow {
+		problems = append(problems, fmt.Sprintf("ranking.maxCandidates must be between 1 and %d", maxResultWindow))
+	}
+
+	return problems
+}
+
+// validate 重みの問題点を返す
+func (w RankingWeights) validate(name string) []string {
+	if w.Distance < 0 || w.Rating < 0 || w.Reviews < 0 || w.OpenNow < 0 {
+		return []string{name + " must not be negative"}
+	}
+	if w.Distance+w.Rating+w.Reviews+w.OpenNow == 0 {
+		return []string{name + " must not all be zero"}
+	}
+	return nil
+}
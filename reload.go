@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// watchConfig SIGHUPを受けたとき，または設定ファイルが更新されたときに設定を再読み込みする
+func watchConfig(args []string) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	go func() {
+		defer recoverJob("watchConfig", nil)
+
+		path := currentConfig().path
+		modified := modTime(path)
+
+		for {
+			interval := time.Duration(currentConfig().ReloadInterval)
+			if interval <= 0 || len(path) == 0 {
+				interval = defaultReloadInterval
+			}
+
+			select {
+			case <-hangup:
+				log.Print("received SIGHUP, reloading config")
+			case <-time.After(interval):
+				if len(path) == 0 || currentConfig().ReloadInterval <= 0 {
+					continue
+				}
+				latest := modTime(path)
+				if latest.Equal(modified) {
+					continue
+				}
+				modified = latest
+				log.Printf("config %s changed, reloading", path)
+			}
+
+			if err := reloadConfig(args); err != nil {
+				log.Printf("config reload rejected, keeping current config: %v", err)
+				continue
+			}
+			log.Print("config reloaded")
+		}
+	}()
+}
+
+// reloadConfig 設定を読み込み直して検証し，問題がなければ差し替える
+func reloadConfig(args []string) error {
+	next, err := loadConfig(args)
+	if err != nil {
+		return err
+	}
+
+	prev := currentConfig()
+	if next.ChannelSecret != prev.ChannelSecret || next.ChannelToken != prev.ChannelToken || next.GCPAPIKey != prev.GCPAPIKey {
+		return errors.New("changing credentials requires a restart")
+	}
+	if next.Port != prev.Port {
+		return errors.New("changing the port requires a restart")
+	}
+	if next.StorePath != prev.StorePath {
+		return errors.New("changing the store path requires a restart")
+	}
+
+	setConfig(next)
+	alerter.update(next)
+	resetUserLimiters()
+
+	return nil
+}
+
+// modTime ファイルの更新時刻を返す．取得できなければゼロ値を返す
+func modTime(path string) time.Time {
+	if len(path) == 0 {
+		return time.Time{}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+// EventContext ハンドラに渡すイベントの情報
+type EventContext struct {
+	Bot      *linebot.Client
+	Config   *Config
+	Event    *linebot.Event
+	Postback *PostbackData
+	Session  *Session
+}
+
+// userID イベントを送ったユーザのIDを返す
+func (ctx *EventContext) userID() string {
+	if ctx.Event.Source == nil {
+		return ""
+	}
+	return ctx.Event.Source.UserID
+}
+
+// eventID ログと通知でイベントを識別するためのIDを返す
+func (ctx *EventContext) eventID() string {
+	return fmt.Sprintf("%s-%d", ctx.userID(), ctx.Event.Timestamp.UnixNano()/int64(time.Millisecond))
+}
+
+// reply イベントのリプライトークンでメッセージを返信する
+func (ctx *EventContext) reply(messages ...linebot.SendingMessage) {
+	if _, err := ctx.Bot.ReplyMessage(ctx.Event.ReplyToken, messages...).Do(); err != nil {
+		log.Print(err)
+	}
+}
+
+// HandlerFunc イベントハンドラ
+type HandlerFunc func(ctx *EventContext)
+
+// Middleware ハンドラを包み，前後に処理を差し込む
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Router イベントの種類，メッセージの種類，ポストバックのアクションごとにハンドラを振り分ける
+type Router struct {
+	events     map[linebot.EventType]HandlerFunc
+	messages   map[linebot.MessageType]HandlerFunc
+	postbacks  map[string]HandlerFunc
+	middleware []Middleware
+}
+
+// router 各ハンドラファイルの init で登録されるルータ
+var router = newRouter()
+
+// newRouter 空のルータを生成
+func newRouter() *Router {
+	return &Router{
+		events:    map[linebot.EventType]HandlerFunc{},
+		messages:  map[linebot.MessageType]HandlerFunc{},
+		postbacks: map[string]HandlerFunc{},
+	}
+}
+
+// use 全てのハンドラに適用するミドルウェアを追加する
+func (r *Router) use(middleware ...Middleware) {
+	r.middleware = append(r.middleware, middleware...)
+}
+
+// onEvent イベントの種類に対するハンドラを登録
+func (r *Router) onEvent(eventType linebot.EventType, handler HandlerFunc, middleware ...Middleware) {
+	r.events[eventType] = chain(handler, middleware)
+}
+
+// onMessage メッセージの種類に対するハンドラを登録
+func (r *Router) onMessage(messageType linebot.MessageType, handler HandlerFunc, middleware ...Middleware) {
+	r.messages[messageType] = chain(handler, middleware)
+}
+
+// onPostback ポストバックのアクションに対するハンドラを登録
+func (r *Router) onPostback(action string, handler HandlerFunc, middleware ...Middleware) {
+	r.postbacks[action] = chain(handler, middleware)
+}
+
+// dispatch イベントに対応するハンドラをミドルウェアを通して実行する
+func (r *Router) dispatch(bot *linebot.Client, event *linebot.Event) {
+	ctx := &EventContext{
+		Bot:    bot,
+		Config: currentConfig(),
+		Event:  event,
+	}
+
+	chain(r.route, r.middleware)(ctx)
+}
+
+// route イベントに対応するハンドラを探して実行する
+func (r *Router) route(ctx *EventContext) {
+	var handler HandlerFunc
+
+	switch ctx.Event.Type {
+	case linebot.EventTypeMessage:
+		handler = r.messages[messageType(ctx.Event.Message)]
+
+	case linebot.EventTypePostback:
+		data, err := codec.decode(ctx.Event.Postback.Data, time.Duration(ctx.Config.PostbackTTL))
+		if err != nil {
+			log.Printf("rejected postback from %s: %v", ctx.userID(), err)
+			ctx.reply(linebot.NewTextMessage("このボタンは無効になりました．もう一度操作して下さい"))
+			return
+		}
+		ctx.Postback = data
+		handler = r.postbacks[data.Action]
+
+	default:
+		handler = r.events[ctx.Event.Type]
+	}
+
+	if handler == nil {
+		log.Printf("no handler for %s event from %s", ctx.Event.Type, ctx.userID())
+		return
+	}
+
+	handler(ctx)
+}
+
+// chain ミドルウェアを登録順に外側から適用する
+func chain(handler HandlerFunc, middleware []Middleware) HandlerFunc {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// messageType 受信したメッセージの種類を返す
+func messageType(message linebot.Message) linebot.MessageType {
+	switch message.(type) {
+	case *linebot.TextMessage:
+		return linebot.MessageTypeText
+	case *linebot.ImageMessage:
+		return linebot.MessageTypeImage
+	case *linebot.VideoMessage:
+		return linebot.MessageTypeVideo
+	case *linebot.AudioMessage:
+		return linebot.MessageTypeAudio
+	case *linebot.FileMessage:
+		return linebot.MessageTypeFile
+	case *linebot.LocationMessage:
+		return linebot.MessageTypeLocation
+	case *linebot.StickerMessage:
+		return linebot.MessageTypeSticker
+	}
+	return ""
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+// replyRecorder 返信APIへのリクエストを受け取り，返信したテキストを記録する
+type replyRecorder struct {
+	mu    sync.Mutex
+	texts []string
+}
+
+func (rr *replyRecorder) replies() []string {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	return append([]string(nil), rr.texts...)
+}
+
+// newTestBot 返信を記録するテスト用のサーバに向けたクライアントを生成
+func newTestBot(t *testing.T) (*linebot.Client, *replyRecorder) {
+	rr := &replyRecorder{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []struct {
+				Text string `json:"text"`
+			} `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode request to %s: %v", r.URL.Path, err)
+		}
+
+		rr.mu.Lock()
+		for _, message := range body.Messages {
+			rr.texts = append(rr.texts, message.Text)
+		}
+		rr.mu.Unlock()
+
+		w.Write([]byte("{}"))
+	}))
+	t.Cleanup(server.Close)
+
+	bot, err := linebot.New("secret", "token", linebot.WithEndpointBase(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bot, rr
+}
+
+// useTestCodec テストの間だけ時刻を固定したcodecを使う
+func useTestCodec(t *testing.T, now time.Time) *PostbackCodec {
+	saved := codec
+	codec = newTestCodec(now)
+	t.Cleanup(func() { codec = saved })
+
+	return codec
+}
+
+func testEvent(eventType linebot.EventType, userID string) *linebot.Event {
+	return &linebot.Event{
+		Type:       eventType,
+		ReplyToken: "reply-token",
+		Source:     &linebot.EventSource{Type: linebot.EventSourceTypeUser, UserID: userID},
+	}
+}
+
+func postbackEvent(t *testing.T, userID string, data PostbackData) *linebot.Event {
+	raw, err := codec.encode(data)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	event := testEvent(linebot.EventTypePostback, userID)
+	event.Postback = &linebot.Postback{Data: raw}
+	return event
+}
+
+func TestRouteSelectsHandler(t *testing.T) {
+	useTestCodec(t, time.Now())
+	bot, _ := newTestBot(t)
+
+	var called []string
+	record := func(name string) HandlerFunc {
+		return func(ctx *EventContext) { called = append(called, name) }
+	}
+
+	r := newRouter()
+	r.onEvent(linebot.EventTypeFollow, record("follow"))
+	r.onMessage(linebot.MessageTypeText, record("text"))
+	r.onMessage(linebot.MessageTypeLocation, record("location"))
+	r.onPostback(actionNext, record("next"))
+	r.onPostback(actionCancel, record("cancel"))
+
+	text := testEvent(linebot.EventTypeMessage, "user")
+	text.Message = &linebot.TextMessage{Text: "渋谷"}
+	location := testEvent(linebot.EventTypeMessage, "user")
+	location.Message = &linebot.LocationMessage{Latitude: 35.6, Longitude: 139.7}
+	sticker := testEvent(linebot.EventTypeMessage, "user")
+	sticker.Message = &linebot.StickerMessage{}
+
+	tests := []struct {
+		name  string
+		event *linebot.Event
+		want  []string
+	}{
+		{name: "event type", event: testEvent(linebot.EventTypeFollow, "user"), want: []string{"follow"}},
+		{name: "text message", event: text, want: []string{"text"}},
+		{name: "location message", event: location, want: []string{"location"}},
+		{name: "postback action", event: postbackEvent(t, "user", PostbackData{Action: actionNext, Page: 2}), want: []string{"next"}},
+		{name: "other postback action", event: postbackEvent(t, "user", PostbackData{Action: actionCancel}), want: []string{"cancel"}},
+		{name: "unregistered message type", event: sticker, want: nil},
+		{name: "unregistered action", event: postbackEvent(t, "user", PostbackData{Action: actionHistory}), want: nil},
+		{name: "unregistered event type", event: testEvent(linebot.EventTypeUnfollow, "user"), want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called = nil
+			r.route(&EventContext{Bot: bot, Config: defaultConfig(), Event: tt.event})
+			if !reflect.DeepEqual(called, tt.want) {
+				t.Errorf("called %v, want %v", called, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoutePassesDecodedPostback(t *testing.T) {
+	useTestCodec(t, time.Now())
+	bot, _ := newTestBot(t)
+
+	var got *PostbackData
+	r := newRouter()
+	r.onPostback(actionNext, func(ctx *EventContext) { got = ctx.Postback })
+
+	r.route(&EventContext{Bot: bot, Config: defaultConfig(), Event: postbackEvent(t, "user", PostbackData{Action: actionNext, Page: 3})})
+	if got == nil || got.Page != 3 {
+		t.Errorf("ctx.Postback = %+v, want page 3", got)
+	}
+}
+
+func TestRouteRejectsInvalidPostback(t *testing.T) {
+	now := time.Now()
+	pc := useTestCodec(t, now)
+
+	valid := postbackEvent(t, "user", PostbackData{Action: actionNext})
+	tampered := testEvent(linebot.EventTypePostback, "user")
+	tampered.Postback = &linebot.Postback{Data: "e30." + valid.Postback.Data[len(valid.Postback.Data)-22:]}
+	legacy := testEvent(linebot.EventTypePostback, "user")
+	legacy.Postback = &linebot.Postback{Data: "category=cafe"}
+
+	tests := []struct {
+		name  string
+		event *linebot.Event
+		after time.Duration
+	}{
+		{name: "tampered", event: tampered},
+		{name: "legacy format", event: legacy},
+		{name: "expired", event: valid, after: postbackTTL + time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pc.now = func() time.Time { return now.Add(tt.after) }
+			bot, rr := newTestBot(t)
+
+			called := false
+			r := newRouter()
+			r.onPostback(actionNext, func(ctx *EventContext) { called = true })
+
+			r.route(&EventContext{Bot: bot, Config: defaultConfig(), Event: tt.event})
+			if called {
+				t.Error("handler was called for an invalid postback")
+			}
+			if want := []string{"このボタンは無効になりました．もう一度操作して下さい"}; !reflect.DeepEqual(rr.replies(), want) {
+				t.Errorf("replies = %q, want %q", rr.replies(), want)
+			}
+		})
+	}
+}
+
+func TestWithSessionContention(t *testing.T) {
+	bot, rr := newTestBot(t)
+
+	var got *Session
+	handler := chain(func(ctx *EventContext) { got = ctx.Session }, []Middleware{withSession})
+
+	session := sessions.get("busy-user")
+	session.mu.Lock()
+	handler(&EventContext{Bot: bot, Config: defaultConfig(), Event: testEvent(linebot.EventTypeMessage, "busy-user")})
+	if got != nil {
+		t.Error("handler ran while the session was locked")
+	}
+	if want := []string{"処理中です．検索が終わってからもう一度お試し下さい"}; !reflect.DeepEqual(rr.replies(), want) {
+		t.Errorf("replies = %q, want %q", rr.replies(), want)
+	}
+
+	session.mu.Unlock()
+	handler(&EventContext{Bot: bot, Config: defaultConfig(), Event: testEvent(linebot.EventTypeMessage, "busy-user")})
+	if got != session {
+		t.Error("handler did not receive the user's session after it was released")
+	}
+	if got != nil && got.SearchData.ReplyToken != "reply-token" {
+		t.Errorf("SearchData.ReplyToken = %q, want the event's reply token", got.SearchData.ReplyToken)
+	}
+}
+
+func TestAdminOnly(t *testing.T) {
+	conf := defaultConfig()
+	conf.AdminUserIDs = []string{"admin"}
+
+	tests := []struct {
+		name    string
+		userID  string
+		allowed bool
+		replies []string
+	}{
+		{name: "admin", userID: "admin", allowed: true},
+		{name: "non-admin", userID: "user", allowed: false, replies: []string{"この操作は管理者のみ実行できます"}},
+		{name: "no user", userID: "", allowed: false, replies: []string{"この操作は管理者のみ実行できます"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot, rr := newTestBot(t)
+
+			called := false
+			r := newRouter()
+			r.onMessage(linebot.MessageTypeText, func(ctx *EventContext) { called = true }, adminOnly)
+
+			event := testEvent(linebot.EventTypeMessage, tt.userID)
+			event.Message = &linebot.TextMessage{Text: "設定再読み込み"}
+			r.route(&EventContext{Bot: bot, Config: conf, Event: event})
+
+			if called != tt.allowed {
+				t.Errorf("handler called = %v, want %v", called, tt.allowed)
+			}
+			if !reflect.DeepEqual(rr.replies(), tt.replies) {
+				t.Errorf("replies = %q, want %q", rr.replies(), tt.replies)
+			}
+		})
+	}
+}
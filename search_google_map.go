@@ -4,7 +4,8 @@ import (
 	"context"
 	"log"
 	"net/http"
-	"os"
+	"sort"
+	"time"
 
 	"googlemaps.github.io/maps"
 )
@@ -12,72 +13,60 @@ import (
 // Client クライアントを生成
 var Client *maps.Client
 
+// pageTokenDelay 次のページのトークンが使えるようになるまで待つ時間
+const pageTokenDelay = 2 * time.Second
+
 const baseURL = "https://maps.googleapis.com/maps/api/place/photo?maxwidth=300&photoreference="
 const noImage = "https://via.placeholder.com/150x150?text=NO%20IMAGE"
 
 // NewClient GoogleMapAPIのクライアントを生成
-func newClient() {
+func newClient(apiKey string) error {
 	var err error
-	Client, err = maps.NewClient(maps.WithAPIKey(os.Getenv("GCP_API")))
+	Client, err = maps.NewClient(maps.WithAPIKey(apiKey))
 
-	if err != nil {
-		log.Fatalf("fatal error: %s", err)
-	}
+	return err
 }
 
-// getGeometryLocation 検索用語を受け取り，地名を検索し，緯度・経度を返す
-func getGeometryLocation(term string) []float64 {
-	request := &maps.GeocodingRequest{
-		Address:  term,
-		Language: "ja",
-	}
-
-	respons, err := Client.Geocode(context.Background(), request)
-	if len(respons) == 0 {
-		return []float64{}
-	}
-	if err != nil {
-		log.Fatalf("fatal error: %s", err)
-	}
-
-	return []float64{respons[0].Geometry.Location.Lat, respons[0].Geometry.Location.Lng}
+// SearchQuery 続きのページの検索にも使う検索条件
+type SearchQuery struct {
+	Origin []float64
+	// Bounds エリアの範囲内を検索するときの南西と北東の緯度・経度
+	Bounds []float64
+	// Text 自由な言葉で検索するときの検索語．空であれば店の種類で検索する
+	Text     string
+	Category CategoryConfig
+	Range    SearchRange
+	Filters  ResultFilters
+	// TravelMode 「ここへ行く」で開く経路の移動手段
+	TravelMode maps.Mode
+	// Explain 管理者向けに各店の順位の理由を確認するボタンを表示する
+	Explain bool
+	// LocationName 検索地点の名前．お気に入りに保存した場所として記録する
+	LocationName string
+	// Favorites お気に入りに保存済みの店．バブルにメモとタグを表示する
+	Favorites map[string]Favorite
 }
 
-// getShopData 緯度経度，検索対象を受け取り，検索し，結果一覧を返す
-func getShopData(location []float64, shopType string) ([][]maps.PlacesSearchResult, string) {
-	keyword, category := getQuery(shopType)
-	if len(keyword) == 0 {
-		log.Fatalln("Invalid shop type")
-	}
+// getShopData 検索条件と検索用語を受け取り，検索し，結果一覧を返す
+func getShopData(query SearchQuery, keyword string, pageSize int) ([][]maps.PlacesSearchResult, string, error) {
+	return searchShops(nearbySearchRequest(query, query.Category, keyword), query, pageSize)
+}
 
+// nearbySearchRequest 検索条件を反映したNearbySearchRequestを構築する
+func nearbySearchRequest(query SearchQuery, category CategoryConfig, keyword string) *maps.NearbySearchRequest {
 	request := &maps.NearbySearchRequest{
-		Location: &maps.LatLng{Lat: location[0], Lng: location[1]},
-		RankBy:   maps.RankByDistance,
+		Location: &maps.LatLng{Lat: query.Origin[0], Lng: query.Origin[1]},
 		Keyword:  keyword,
-		Type:     category,
+		Type:     category.PlaceType,
 	}
+	query.Range.apply(request)
+	query.Filters.apply(request)
 
-	return searchShops(request)
+	return request
 }
 
-// getQuery 検索対象を受け取り，それに応じた検索用語と検索場所の種類を返す
-func getQuery(shopType string) (string, maps.PlaceType) {
-	switch shopType {
-	case "used":
-		return "男性古着屋", maps.PlaceTypeClothingStore
-	case "select":
-		return "男性セレクトショップ", maps.PlaceTypeClothingStore
-	case "other":
-		return "(男性衣料品ブランド) || (Clothing Brand && Men)", maps.PlaceTypeClothingStore
-	case "cafe":
-		return "カフェ || Cafe", maps.PlaceTypeCafe
-	}
-
-	return "", ""
-}
-
-// GetPlaceDetails 位置情報を受け取り，その位置の詳細情報を取得し，返す
-func getPlaceDetails(placeID string) maps.PlaceDetailsResult {
+// getPlaceDetails 店の詳細情報を取得し，返す．閉店した店や API の制限で取得できなければエラーを返す
+func getPlaceDetails(placeID string) (maps.PlaceDetailsResult, error) {
 	detailRequest := &maps.PlaceDetailsRequest{
 		PlaceID:  placeID,
 		Language: "ja",
@@ -94,16 +83,11 @@ func getPlaceDetails(placeID string) maps.PlaceDetailsResult {
 		},
 	}
 
-	detailResult, err := Client.PlaceDetails(context.Background(), detailRequest)
-	if err != nil {
-		log.Fatalf("fatal error: %s", err)
-	}
-
-	return detailResult
+	return Client.PlaceDetails(context.Background(), detailRequest)
 }
 
 // GetPlacePhotos 写真参照コードを受け取り，写真を最大3枚取得し，返す
-func getPlacePhotos(photos []maps.Photo) []string {
+func getPlacePhotos(apiKey string, photos []maps.Photo) []string {
 	var photoResponses []string
 	for i := 0; i < 3; i++ {
 		photoResponses = append(photoResponses, noImage)
@@ -114,15 +98,21 @@ func getPlacePhotos(photos []maps.Photo) []string {
 			break
 		}
 
-		photoResponses[index] = getPlacePhotoURL(photo.PhotoReference)
+		photoURL, err := getPlacePhotoURL(apiKey, photo.PhotoReference)
+		if err != nil {
+			// 写真がなくても店の情報は表示できるため，代わりの画像にする
+			log.Printf("photo %s failed: %v", photo.PhotoReference, err)
+			continue
+		}
+		photoResponses[index] = photoURL
 	}
 
 	return photoResponses
 }
 
 // getPlacePhotoURL 写真参照コードを受け取り，写真のURLを返す
-func getPlacePhotoURL(photoReference string) string {
-	photoURL := baseURL + photoReference + "&key=" + os.Getenv("GCP_API")
+func getPlacePhotoURL(apiKey string, photoReference string) (string, error) {
+	photoURL := baseURL + photoReference + "&key=" + apiKey
 
 	client := &http.Client{
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
@@ -131,43 +121,126 @@ func getPlacePhotoURL(photoReference string) string {
 	}
 	resp, err := client.Get(photoURL)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 	defer resp.Body.Close()
 
 	if len(resp.Header["Location"]) > 0 {
-		return resp.Header["Location"][0]
+		return resp.Header["Location"][0], nil
 	}
 
-	return noImage
+	return noImage, nil
 }
 
-// getNextShops 次の20件の検索結果一覧を返す
-func getNextShops(nextPageToken string) ([][]maps.PlacesSearchResult, string) {
-	request := &maps.NearbySearchRequest{
-		PageToken: nextPageToken,
+// searchShops リクエスト内容を受け取り，NearbySearchRequestを行い，検索結果一覧と次の20件の検索結果一覧にアクセスするトークンを返す
+func searchShops(request *maps.NearbySearchRequest, query SearchQuery, pageSize int) ([][]maps.PlacesSearchResult, string, error) {
+	results, nextPageToken, err := searchPlaces(request, query)
+	if err != nil {
+		return nil, "", err
+	}
+	results, nextPageToken, err = fillPage(results, nextPageToken, query, pageSize)
+	if err != nil {
+		return nil, "", err
 	}
 
-	return searchShops(request)
+	return splitShops(results, pageSize), nextPageToken, nil
 }
 
-// searchShops リクエスト内容を受け取り，NearbySearchRequestを行い，検索結果一覧と次の20件の検索結果一覧にアクセスするトークンを返す
-func searchShops(request *maps.NearbySearchRequest) ([][]maps.PlacesSearchResult, string) {
-	response, err := Client.NearbySearch(context.Background(), request)
+// fillPage 絞り込みで減った分を補うため，1ページ分の店が集まるか次のページがなくなるまで検索を続ける
+func fillPage(results []maps.PlacesSearchResult, nextPageToken string, query SearchQuery, pageSize int) ([]maps.PlacesSearchResult, string, error) {
+	for len(results) < pageSize && len(nextPageToken) > 0 {
+		// 発行直後のトークンはまだ使えないため少し待つ
+		time.Sleep(pageTokenDelay)
+
+		shops, token, err := searchPlaces(&maps.NearbySearchRequest{PageToken: nextPageToken}, query)
+		if err != nil {
+			return nil, "", err
+		}
+		results = append(results, shops...)
+		nextPageToken = token
+	}
+
+	return results, nextPageToken, nil
+}
+
+// searchPlaces NearbySearchRequestまたはTextSearchRequestを行い，絞り込み条件に合わない店と検索範囲外の店を除いた検索結果と次の20件にアクセスするトークンを返す
+func searchPlaces(request *maps.NearbySearchRequest, query SearchQuery) ([]maps.PlacesSearchResult, string, error) {
+	response, err := requestPlaces(request, query)
 	if err != nil {
-		log.Fatalf("fatal error: %s", err)
+		return nil, "", err
+	}
+
+	filters := append(query.Filters.shopFilters(), excludeKeywords(query.Category))
+	nextPageToken := response.NextPageToken
+	var results []maps.PlacesSearchResult
+	for _, shop := range response.Results {
+		// 自由な言葉での検索は近い順に並ばず，エリアの検索は範囲をエリアで決めるため，検索範囲で打ち切らない
+		if !query.isTextSearch() && !query.isAreaSearch() && !query.Range.contains(query.Origin, shop) {
+			// 近い順に並んでいるため，範囲外の店以降は全て範囲外になる
+			nextPageToken = ""
+			continue
+		}
+		if matchesAll(filters, shop) {
+			results = append(results, shop)
+		}
+	}
+
+	return results, nextPageToken, nil
+}
 
+// requestPlaces 検索条件に応じて Nearby Search か Text Search を行う
+func requestPlaces(request *maps.NearbySearchRequest, query SearchQuery) (maps.PlacesSearchResponse, error) {
+	if query.isTextSearch() {
+		return Client.TextSearch(context.Background(), textSearchRequest(query, request.PageToken))
 	}
+	return Client.NearbySearch(context.Background(), request)
+}
+
+// getShopDataForCategories 複数の店の種類をそれぞれ検索し，重複を除いて近い順に並べた結果一覧を返す
+func getShopDataForCategories(query SearchQuery, categories []CategoryConfig, keywords []string, pageSize int) ([][]maps.PlacesSearchResult, error) {
+	var results []maps.PlacesSearchResult
+	seen := map[string]bool{}
+
+	for i, category := range categories {
+		categoryQuery := query
+		categoryQuery.Category = category
+
+		shops, nextPageToken, err := searchPlaces(nearbySearchRequest(query, category, keywords[i]), categoryQuery)
+		if err != nil {
+			return nil, err
+		}
+		shops, _, err = fillPage(shops, nextPageToken, categoryQuery, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, shop := range shops {
+			if !seen[shop.PlaceID] {
+				seen[shop.PlaceID] = true
+				results = append(results, shop)
+			}
+		}
+	}
+
+	if query.Range.RankBy != rankByProminence {
+		sort.SliceStable(results, func(i, j int) bool {
+			return distance(query.Origin, results[i].Geometry.Location) < distance(query.Origin, results[j].Geometry.Location)
+		})
+	}
+
+	return splitShops(results, pageSize), nil
+}
 
+// splitShops 検索結果一覧を最初のページとそれ以降に分ける
+func splitShops(results []maps.PlacesSearchResult, pageSize int) [][]maps.PlacesSearchResult {
 	var shops [][]maps.PlacesSearchResult = make([][]maps.PlacesSearchResult, 2)
 
-	for index, shopResult := range response.Results {
-		if index < 10 {
+	for index, shopResult := range results {
+		if index < pageSize {
 			shops[0] = append(shops[0], shopResult)
 		} else {
 			shops[1] = append(shops[1], shopResult)
 		}
 	}
 
-	return shops, response.NextPageToken
+	return shops
 }
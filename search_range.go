@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"googlemaps.github.io/maps"
+)
+
+// 検索結果の並び順
+const (
+	rankByDistance   = "distance"
+	rankByProminence = "prominence"
+	rankByScore      = "score"
+)
+
+// defaultProminenceRadius 範囲を指定せずに人気順で検索するときの半径（メートル）
+const defaultProminenceRadius = 3000
+
+// SearchRange 検索範囲と並び順
+type SearchRange struct {
+	Radius uint
+	RankBy string
+}
+
+// defaultRadiusOptions 選べる検索範囲の既定値（メートル）
+func defaultRadiusOptions() []uint {
+	return []uint{500, 1000, 3000}
+}
+
+// apply 検索範囲と並び順をリクエストに反映する．距離順では半径を指定できないため検索後に絞り込む．
+// おすすめ順では人気順で候補を集めてから並べ替える
+func (sr SearchRange) apply(request *maps.NearbySearchRequest) {
+	if sr.RankBy == rankByProminence || sr.RankBy == rankByScore {
+		request.RankBy = maps.RankByProminence
+		request.Radius = sr.Radius
+		if request.Radius == 0 {
+			request.Radius = defaultProminenceRadius
+		}
+		return
+	}
+
+	request.RankBy = maps.RankByDistance
+}
+
+// contains 距離順で検索した店が検索範囲内にあるか判定する．人気順とおすすめ順では半径をリクエストに含めるため常に範囲内とする
+func (sr SearchRange) contains(origin []float64, shop maps.PlacesSearchResult) bool {
+	if sr.RankBy == rankByProminence || sr.RankBy == rankByScore || sr.Radius == 0 {
+		return true
+	}
+	return distance(origin, shop.Geometry.Location) <= float64(sr.Radius)
+}
+
+// describe 検索範囲と並び順の説明を返す
+func (sr SearchRange) describe() string {
+	radius := "制限なし"
+	if sr.Radius > 0 {
+		radius = formatDistance(sr.Radius) + "以内"
+	}
+
+	return radius + "・" + sr.rankByName()
+}
+
+// describeArea エリアの範囲内を検索するときの検索範囲と並び順の説明を返す
+func (sr SearchRange) describeArea() string {
+	return "エリア内・" + sr.rankByName()
+}
+
+// rankByName 並び順の名前を返す
+func (sr SearchRange) rankByName() string {
+	switch sr.RankBy {
+	case rankByProminence:
+		return "人気順"
+	case rankByScore:
+		return "おすすめ順"
+	}
+	return "近い順"
+}
+
+// searchRange プロフィールに保存された検索範囲と並び順を返す
+func (p UserProfile) searchRange() SearchRange {
+	return SearchRange{
+		Radius: p.Radius,
+		RankBy: p.RankBy,
+	}
+}
+
+// hasSearchRange 検索範囲と並び順を選んだことがあるか判定する
+func (p UserProfile) hasSearchRange() bool {
+	return len(p.RankBy) > 0
+}
+
+// searchRangeQuickReplies 検索範囲と並び順の組み合わせを選ぶクイックリプライを構築する
+func searchRangeQuickReplies(options []uint, current SearchRange) *linebot.QuickReplyItems {
+	ranges := []SearchRange{{RankBy: rankByDistance}}
+	for _, rankBy := range []string{rankByDistance, rankByProminence, rankByScore} {
+		for _, radius := range options {
+			ranges = append(ranges, SearchRange{Radius: radius, RankBy: rankBy})
+		}
+	}
+
+	var buttons []*linebot.QuickReplyButton
+	for _, r := range ranges {
+		if len(buttons) == maxQuickReplyItems {
+			break
+		}
+		buttons = append(buttons, postbackQuickReply(checkLabel(r.describe(), r == current), PostbackData{
+			Action: actionRange,
+			Filters: map[string]string{
+				"radius": strconv.FormatUint(uint64(r.Radius), 10),
+				"rank":   r.RankBy,
+			},
+		}))
+	}
+
+	return quickReplyItems(buttons...)
+}
+
+// formatDistance 距離をメートルまたはキロメートルで表記する
+func formatDistance(meters uint) string {
+	if meters < 1000 {
+		return fmt.Sprintf("%dm", meters)
+	}
+	return strconv.FormatFloat(float64(meters)/1000, 'f', -1, 64) + "km"
+}
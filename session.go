@@ -0,0 +1,38 @@
+package main
+
+import "sync"
+
+// Session ユーザごとの検索状態
+type Session struct {
+	mu         sync.Mutex
+	ShopData   *ShopData
+	SearchData *SearchData
+	// Pending 次のテキストメッセージで受け取るリスト名やメモ
+	Pending *PendingInput
+}
+
+// SessionStore ユーザIDごとにセッションを保持する
+type SessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+// sessions 全ユーザのセッション
+var sessions = &SessionStore{sessions: map[string]*Session{}}
+
+// get ユーザのセッションを返す．なければ生成する
+func (ss *SessionStore) get(userID string) *Session {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	session, ok := ss.sessions[userID]
+	if !ok {
+		session = &Session{
+			ShopData:   &ShopData{},
+			SearchData: initializeSearchData(),
+		}
+		ss.sessions[userID] = session
+	}
+
+	return session
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image/png"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"googlemaps.github.io/maps"
+)
+
+// mapImagePath 地図画像を配信するパス
+const mapImagePath = "/maps/"
+
+const (
+	// mapImageTTL 地図画像を配信し続ける時間
+	mapImageTTL = 24 * time.Hour
+	// maxMapImages 保持する地図画像の最大数
+	maxMapImages = 500
+)
+
+// markerLabels 地図のピンと店のバブルに付ける番号．ピンには1文字しか書けないため10件目以降は英字にする
+const markerLabels = "123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// mapImages 配信する地図画像
+var mapImages = &MapImageCache{images: map[string]*mapImage{}}
+
+var errMapImage = errors.New("map image: rendering failed")
+
+// MapImageCache 地図画像のリクエストと生成した画像を保持する．画像は最初に要求されたときに生成する
+type MapImageCache struct {
+	mu     sync.Mutex
+	images map[string]*mapImage
+	order  []string
+}
+
+// mapImage 地図画像1枚分のリクエストと生成結果
+type mapImage struct {
+	once     sync.Once
+	request  *maps.StaticMapRequest
+	data     []byte
+	err      error
+	issuedAt time.Time
+}
+
+// markerLabel 何番目の店かを表す番号を返す
+func markerLabel(index int) string {
+	if index < 0 || index >= len(markerLabels) {
+		return ""
+	}
+	return markerLabels[index : index+1]
+}
+
+// overviewMapRequest 検索地点と番号付きの店のピンを載せた地図のリクエストを構築する
+func overviewMapRequest(origin []float64, shops []maps.PlacesSearchResult) *maps.StaticMapRequest {
+	request := &maps.StaticMapRequest{
+		Size:     "600x400",
+		Scale:    2,
+		Language: "ja",
+	}
+	if len(origin) > 0 {
+		request.Markers = append(request.Markers, maps.Marker{
+			Color:    "blue",
+			Location: []maps.LatLng{{Lat: origin[0], Lng: origin[1]}},
+		})
+	}
+
+	for index, shop := range shops {
+		label := markerLabel(index)
+		if len(label) == 0 {
+			break
+		}
+		request.Markers = append(request.Markers, maps.Marker{
+			Color:    "red",
+			Label:    label,
+			Location: []maps.LatLng{shop.Geometry.Location},
+		})
+	}
+
+	return request
+}
+
+// add 地図画像のリクエストを登録し，画像のURLを返す．公開URLが設定されていなければ空文字を返す
+func (c *MapImageCache) add(publicURL string, request *maps.StaticMapRequest) string {
+	if len(publicURL) == 0 {
+		return ""
+	}
+
+	id := uuid.New().String()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.evict(time.Now())
+	c.images[id] = &mapImage{request: request, issuedAt: time.Now()}
+	c.order = append(c.order, id)
+
+	return strings.TrimSuffix(publicURL, "/") + mapImagePath + id + ".png"
+}
+
+// evict 期限切れの画像と上限を超えた古い画像を捨てる
+func (c *MapImageCache) evict(now time.Time) {
+	for len(c.order) > 0 {
+		oldest := c.images[c.order[0]]
+		if oldest != nil && now.Sub(oldest.issuedAt) < mapImageTTL && len(c.order) < maxMapImages {
+			break
+		}
+		delete(c.images, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// get 地図画像を返す．まだ生成していなければ StaticMap API で生成する
+func (c *MapImageCache) get(id string) ([]byte, bool, error) {
+	c.mu.Lock()
+	image, ok := c.images[id]
+	c.mu.Unlock()
+	if !ok || time.Since(image.issuedAt) >= mapImageTTL {
+		return nil, false, nil
+	}
+
+	image.once.Do(func() {
+		defer recoverJob("renderMapImage", func() {
+			image.err = errMapImage
+		})
+
+		rendered, err := Client.StaticMap(context.Background(), image.request)
+		if err != nil {
+			image.err = err
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, rendered); err != nil {
+			image.err = err
+			return
+		}
+		image.data = buf.Bytes()
+	})
+
+	return image.data, true, image.err
+}
+
+// serveMapImage 地図画像を配信する．APIキーを含むURLを利用者に渡さないよう，ボットが代わりに取得する
+func serveMapImage(w http.ResponseWriter, req *http.Request) {
+	id := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, mapImagePath), ".png")
+
+	data, ok, err := mapImages.get(id)
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	if err != nil {
+		log.Printf("failed to render map %s: %v", id, err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	if _, err := w.Write(data); err != nil {
+		log.Print(err)
+	}
+}
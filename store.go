@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// store ユーザごとのデータを永続化する
+var store *Store
+
+// Store ユーザごとのデータをJSONファイルに保存する
+type Store struct {
+	mu    sync.Mutex
+	path  string
+	Users map[string]*UserProfile `json:"users"`
+}
+
+// warnEphemeralStore Heroku の dyno ではファイルが再起動のたびに消えるため，保存したデータが残らないことを警告する
+func warnEphemeralStore(path string) {
+	if len(os.Getenv("DYNO")) == 0 {
+		return
+	}
+	log.Printf("store %s is on the dyno's ephemeral filesystem: favorites and search history are lost on every restart or deploy", path)
+}
+
+// openStore 保存先のファイルを読み込み，Storeを生成する．ファイルがなければ空で始める
+func openStore(path string) (*Store, error) {
+	s := &Store{
+		path:  path,
+		Users: map[string]*UserProfile{},
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	if s.Users == nil {
+		s.Users = map[string]*UserProfile{}
+	}
+
+	return s, nil
+}
+
+// profile ユーザのプロフィールの複製を返す
+func (s *Store) profile(userID string) UserProfile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if profile, ok := s.Users[userID]; ok {
+		return profile.clone()
+	}
+	return UserProfile{}
+}
+
+// updateProfile ユーザのプロフィールの複製を変更して保存する．保存に失敗すれば変更前のプロフィールに戻す
+func (s *Store) updateProfile(userID string, update func(profile *UserProfile)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, ok := s.Users[userID]
+	var profile UserProfile
+	if ok {
+		profile = prev.clone()
+	}
+	update(&profile)
+
+	s.Users[userID] = &profile
+	if err := s.save(); err != nil {
+		if ok {
+			s.Users[userID] = prev
+		} else {
+			delete(s.Users, userID)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// save 一時ファイルに書き出してから置き換え，書き込み途中のファイルが残らないようにする
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if dir := filepath.Dir(s.path); len(dir) > 0 {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"googlemaps.github.io/maps"
+)
+
+// textSearchPrefixes 自由な言葉で検索するメッセージの先頭に付ける言葉
+var textSearchPrefixes = []string{"検索", "探す", "さがす"}
+
+// textSearchQuery メッセージが自由な言葉での検索であれば，先頭の言葉を除いた検索語を返す
+func textSearchQuery(text string) (string, bool) {
+	text = strings.TrimSpace(text)
+	for _, prefix := range textSearchPrefixes {
+		if !strings.HasPrefix(text, prefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(text, prefix)
+		if len(rest) > 0 && !unicode.IsSpace([]rune(rest)[0]) {
+			continue
+		}
+		return strings.TrimSpace(rest), true
+	}
+	return "", false
+}
+
+// isTextSearch 自由な言葉での検索か判定する
+func (q SearchQuery) isTextSearch() bool {
+	return len(q.Text) > 0
+}
+
+// textSearchRequest 検索条件を反映したTextSearchRequestを構築する．検索地点があればその周辺を優先する
+func textSearchRequest(query SearchQuery, pageToken string) *maps.TextSearchRequest {
+	if len(pageToken) > 0 {
+		return &maps.TextSearchRequest{PageToken: pageToken}
+	}
+
+	request := &maps.TextSearchRequest{
+		Query:    query.Text,
+		Language: "ja",
+		OpenNow:  query.Filters.OpenNow,
+	}
+	if len(query.Origin) > 0 {
+		request.Location = &maps.LatLng{Lat: query.Origin[0], Lng: query.Origin[1]}
+		request.Radius = query.Range.Radius
+		if request.Radius == 0 {
+			request.Radius = defaultProminenceRadius
+		}
+	}
+
+	return request
+}
+
+// buildAndSendTextSearchMessage 自由な言葉で検索し，結果のFlexMessageを送信する
+func buildAndSendTextSearchMessage(bot *linebot.Client, conf *Config, text string, searchData *SearchData, profile UserProfile) *ShopData {
+	replyToken := searchData.ReplyToken
+	query := SearchQuery{
+		Origin:  searchData.Location,
+		Text:    text,
+		Range:   profile.searchRange(),
+		Filters: profile.Filters,
+
+		TravelMode:   profile.travelMode(),
+		LocationName: searchData.LocationName,
+		Favorites:    profile.favoritesByPlaceID(),
+	}
+
+	// Text Search は検索語だけで検索するため，Nearby Search の条件は空にする
+	shops, nextPageToken, err := searchShops(&maps.NearbySearchRequest{}, query, conf.PageSize)
+	if err != nil {
+		reportError("text search", text, err)
+		if _, err := bot.ReplyMessage(replyToken, linebot.NewTextMessage(apologyText)).Do(); err != nil {
+			log.Print(err)
+		}
+		return &ShopData{}
+	}
+	if len(shops[0]) == 0 {
+		var buttons []*linebot.QuickReplyButton
+		if query.Filters.narrows() {
+			buttons = append(buttons, postbackQuickReply("絞り込み", PostbackData{Action: actionFilterMenu}))
+		}
+		buttons = append(buttons, postbackQuickReply("場所を変更", PostbackData{Action: actionChangeLocation}))
+		message := linebot.NewTextMessage("「" + text + "」に当てはまるお店が見つかりませんでした．言葉を変えて検索して下さい")
+		if _, err := bot.ReplyMessage(replyToken, message.WithQuickReplies(quickReplyItems(buttons...))).Do(); err != nil {
+			log.Print(err)
+		}
+		return &ShopData{}
+	}
+
+	shopData, err := sendSearchResults(conf, searchData.UserID, newSearchHistory(query, nil), shops, query, replyToken, nextPageToken)
+	if err != nil {
+		reportError("text search", text, err)
+		if _, err := bot.ReplyMessage(replyToken, linebot.NewTextMessage(apologyText)).Do(); err != nil {
+			log.Print(err)
+		}
+		return &ShopData{}
+	}
+	shopData.Query = query
+
+	return shopData
+}
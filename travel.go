@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+
+	"googlemaps.github.io/maps"
+)
+
+// walkingMetersPerMinute 徒歩の所要時間を見積もる速さ（不動産の表示規約と同じ分速80m）
+const walkingMetersPerMinute = 80
+
+// 所要時間の求め方
+const (
+	travelStraight = "straight"
+	travelMatrix   = "matrix"
+)
+
+// TravelConfig 検索結果に表示する所要時間の設定
+type TravelConfig struct {
+	Provider string    `json:"provider"`
+	Mode     maps.Mode `json:"mode"`
+	Groups   []int     `json:"groups"`
+	// InlineRoute 経路の要約をトークで返すボタンを表示する
+	InlineRoute bool `json:"inlineRoute"`
+}
+
+// Travel 検索地点から店までの距離と所要時間
+type Travel struct {
+	Meters    float64
+	Minutes   int
+	Mode      maps.Mode
+	Estimated bool
+}
+
+// defaultTravelConfig 所要時間の設定の既定値
+func defaultTravelConfig() TravelConfig {
+	return TravelConfig{
+		Provider: travelStraight,
+		Mode:     maps.TravelModeWalking,
+		Groups:   []int{5, 10, 20},
+	}
+}
+
+// estimateTravels 店ごとの距離と所要時間を返す．検索地点がなければ空を返す．Distance Matrix API を使う設定で取得に失敗した場合は直線距離からの見積もりを返す
+func estimateTravels(tc TravelConfig, origin []float64, shops []maps.PlacesSearchResult) map[string]Travel {
+	travels := map[string]Travel{}
+	if len(origin) == 0 {
+		return travels
+	}
+
+	for _, shop := range shops {
+		meters := distance(origin, shop.Geometry.Location)
+		travels[shop.PlaceID] = Travel{
+			Meters:    meters,
+			Minutes:   int(math.Ceil(meters / walkingMetersPerMinute)),
+			Mode:      maps.TravelModeWalking,
+			Estimated: true,
+		}
+	}
+
+	if tc.Provider == travelMatrix && len(shops) > 0 {
+		if err := fetchTravelTimes(tc.Mode, origin, shops, travels); err != nil {
+			log.Printf("distance matrix failed, using straight-line estimates: %v", err)
+		}
+	}
+
+	return travels
+}
+
+// fetchTravelTimes Distance Matrix API で実際の経路の所要時間を取得し，見積もりを置き換える
+func fetchTravelTimes(mode maps.Mode, origin []float64, shops []maps.PlacesSearchResult, travels map[string]Travel) error {
+	var destinations []string
+	for _, shop := range shops {
+		destinations = append(destinations, "place_id:"+shop.PlaceID)
+	}
+
+	request := &maps.DistanceMatrixRequest{
+		Origins:      []string{fmt.Sprintf("%f,%f", origin[0], origin[1])},
+		Destinations: destinations,
+		Mode:         mode,
+		Language:     "ja",
+	}
+	if mode == maps.TravelModeTransit {
+		request.DepartureTime = "now"
+	}
+
+	response, err := Client.DistanceMatrix(context.Background(), request)
+	if err != nil {
+		return err
+	}
+	if len(response.Rows) == 0 || len(response.Rows[0].Elements) != len(shops) {
+		return fmt.Errorf("unexpected distance matrix response for %d destinations", len(shops))
+	}
+
+	for i, element := range response.Rows[0].Elements {
+		if element.Status != "OK" {
+			continue
+		}
+		travel := travels[shops[i].PlaceID]
+		travel.Minutes = int(math.Ceil(element.Duration.Minutes()))
+		travel.Mode = mode
+		travel.Estimated = false
+		travels[shops[i].PlaceID] = travel
+	}
+
+	return nil
+}
+
+// modeName 移動手段の表記を返す
+func modeName(mode maps.Mode) string {
+	switch mode {
+	case maps.TravelModeTransit:
+		return "電車・バス"
+	case maps.TravelModeDriving:
+		return "車"
+	case maps.TravelModeBicycling:
+		return "自転車"
+	}
+	return "徒歩"
+}
+
+// describe 距離と所要時間の説明を返す
+func (t Travel) describe() string {
+	minutes := fmt.Sprintf("%d分", t.Minutes)
+	if t.Estimated {
+		minutes = "約" + minutes
+	}
+	return formatDistance(uint(math.Round(t.Meters))) + "・" + modeName(t.Mode) + minutes
+}
+
+// travelSummary 所要時間ごとの店の数をまとめた説明を返す．代替テキストに使う．
+// 行列APIで求められなかった店は徒歩の推定になるため，移動手段ごとに分けて数える
+func travelSummary(shops []maps.PlacesSearchResult, travels map[string]Travel, groups []int) string {
+	var modes []maps.Mode
+	counts := map[maps.Mode][]int{}
+	for _, shop := range shops {
+		travel, ok := travels[shop.PlaceID]
+		if !ok {
+			continue
+		}
+		if _, ok := counts[travel.Mode]; !ok {
+			modes = append(modes, travel.Mode)
+			counts[travel.Mode] = make([]int, len(groups)+1)
+		}
+
+		group := len(groups)
+		for i, minutes := range groups {
+			if travel.Minutes <= minutes {
+				group = i
+				break
+			}
+		}
+		counts[travel.Mode][group]++
+	}
+
+	var parts []string
+	for _, mode := range modes {
+		for i, count := range counts[mode] {
+			if count == 0 {
+				continue
+			}
+			if i < len(groups) {
+				parts = append(parts, fmt.Sprintf("%s%d分以内 %d件", modeName(mode), groups[i], count))
+			} else if len(modes) > 1 {
+				parts = append(parts, fmt.Sprintf("%sでそれ以上 %d件", modeName(mode), count))
+			} else {
+				parts = append(parts, fmt.Sprintf("それ以上 %d件", count))
+			}
+		}
+	}
+
+	return strings.Join(parts, " / ")
+}
+
+// validate 所要時間の設定の問題点を返す
+func (tc TravelConfig) validate() []string {
+	var problems []string
+
+	if tc.Provider != travelStraight && tc.Provider != travelMatrix {
+		problems = append(problems, fmt.Sprintf("travel.provider must be %q or %q", travelStraight, travelMatrix))
+	}
+	switch tc.Mode {
+	case maps.TravelModeWalking, maps.TravelModeTransit, maps.TravelModeDriving, maps.TravelModeBicycling:
+	default:
+		problems = append(problems, fmt.Sprintf("travel.mode %q is not a travel mode", tc.Mode))
+	}
+	for i, minutes := range tc.Groups {
+		if minutes <= 0 || (i > 0 && minutes <= tc.Groups[i-1]) {
+			problems = append(problems, "travel.groups must be positive and increasing")
+			break
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	"googlemaps.github.io/maps"
+)
+
+func TestTravelSummary(t *testing.T) {
+	shops := []maps.PlacesSearchResult{{PlaceID: "a"}, {PlaceID: "b"}, {PlaceID: "c"}, {PlaceID: "d"}}
+	groups := []int{5, 10}
+
+	tests := []struct {
+		name    string
+		travels map[string]Travel
+		want    string
+	}{
+		{
+			name: "one mode",
+			travels: map[string]Travel{
+				"a": {Minutes: 3, Mode: maps.TravelModeWalking},
+				"b": {Minutes: 8, Mode: maps.TravelModeWalking},
+				"c": {Minutes: 30, Mode: maps.TravelModeWalking},
+			},
+			want: "徒歩5分以内 1件 / 徒歩10分以内 1件 / それ以上 1件",
+		},
+		{
+			name: "estimates mixed with transit times",
+			travels: map[string]Travel{
+				"a": {Minutes: 4, Mode: maps.TravelModeTransit},
+				"b": {Minutes: 12, Mode: maps.TravelModeTransit},
+				"c": {Minutes: 9, Mode: maps.TravelModeWalking, Estimated: true},
+				"d": {Minutes: 40, Mode: maps.TravelModeWalking, Estimated: true},
+			},
+			want: "電車・バス5分以内 1件 / 電車・バスでそれ以上 1件 / 徒歩10分以内 1件 / 徒歩でそれ以上 1件",
+		},
+		{name: "no travels", travels: map[string]Travel{}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := travelSummary(shops, tt.travels, groups); got != tt.want {
+				t.Errorf("travelSummary = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}